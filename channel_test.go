@@ -3,71 +3,38 @@ package main
 //最后的 https://mp.weixin.qq.com/s/QgNndPgN1kqxWh-ijSofkw
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
-)
-
-type intMap map[int]int
-
-type ConcurrentMap struct {
-	mu     sync.RWMutex
-	data   intMap
-	readCh chan []int
-}
-
-func (cm *ConcurrentMap) Put(k, v int) {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
-	ints := []int{k, v}
-	cm.readCh <- ints
-}
-
-func (cm *ConcurrentMap) Get(k int, maxWaitingTime time.Duration) (int, error) {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
 
-	v, ok := cm.data[k]
-	if ok {
-		return v, nil
-	}
-	select {
-	case data := <-cm.readCh:
-		// 类型检查
-		cm.data[data[0]] = data[1]
-		if k == data[0] {
-			return data[1], nil
-		}
-	case <-time.After(maxWaitingTime):
-		return 0, fmt.Errorf("超时错误。。。")
-	}
-	return 0, nil
-}
+	"review/cmap"
+)
 
 func TestConcurrentMap(t *testing.T) {
-	concurrentMap := ConcurrentMap{
-		data:   make(intMap),
-		readCh: make(chan []int),
-	}
+	concurrentMap := cmap.New[int, int]()
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		v, _ := concurrentMap.Get(1, time.Second)
-		t.Log("v", v)
+		// 只会被键 1 的写入唤醒，最多等待一秒
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		v, err := concurrentMap.WaitFor(ctx, 1)
+		t.Log("v", v, err)
 	}()
 
 	go func() {
 		defer wg.Done()
+		// 没有读者时也不会阻塞
 		concurrentMap.Put(1, 2)
 	}()
 
 	wg.Wait()
-	close(concurrentMap.readCh)
 }
 
 func TestDataRace(t *testing.T) {
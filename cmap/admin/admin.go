@@ -0,0 +1,246 @@
+// Package admin 把 cmap.ConcurrentMap 暴露为 HTTP 接口：
+//
+//	GET    /kv/{key}            读取值，?wait=5s 在键不存在时长轮询等待它出现
+//	PUT    /kv/{key}            写入请求体，?ttl=30s 设置过期时间
+//	DELETE /kv/{key}            删除
+//	GET    /kv?prefix=&after=&limit=   按键排序分页列出
+//	GET    /stats               命中率、淘汰等统计信息
+//
+// 所有等待都以请求自身的 ctx 为上限，客户端断开或服务器关闭时立即返回。
+package admin
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"review/cmap"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	maxWait      = time.Minute
+	maxValueSize = 1 << 20
+)
+
+// Handler 实现 http.Handler。
+type Handler struct {
+	m   *cmap.ConcurrentMap[string, string]
+	mux *http.ServeMux
+}
+
+// NewHandler 创建以 m 为存储的 Handler。
+func NewHandler(m *cmap.ConcurrentMap[string, string]) *Handler {
+	h := &Handler{m: m, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /kv", h.list)
+	h.mux.HandleFunc("GET /kv/{key...}", h.get)
+	h.mux.HandleFunc("PUT /kv/{key...}", h.put)
+	h.mux.HandleFunc("DELETE /kv/{key...}", h.delete)
+	h.mux.HandleFunc("GET /stats", h.stats)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		h.list(w, r)
+		return
+	}
+
+	wait, err := durationParam(r, "wait")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wait == 0 {
+		v, ok := h.m.Get(key)
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		writeValue(w, v)
+		return
+	}
+
+	// 等待时间同时受 ?wait 和请求 ctx 约束，客户端先断开时 WaitFor 随之返回
+	ctx, cancel := context.WithTimeout(r.Context(), min(wait, maxWait))
+	defer cancel()
+	v, err := h.m.WaitFor(ctx, key)
+	switch {
+	case err == nil:
+		writeValue(w, v)
+	case errors.Is(err, cmap.ErrTimeout):
+		http.Error(w, "key not found", http.StatusNotFound)
+	default:
+		// 客户端已经离开，回复不会被读到
+	}
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		http.Error(w, "empty key", http.StatusBadRequest)
+		return
+	}
+	ttl, err := durationParam(r, "ttl")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if ttl > 0 {
+		h.m.PutWithTTL(key, string(body), ttl)
+	} else {
+		h.m.Put(key, string(body))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	if !h.m.Delete(r.PathValue("key")) {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Item 是列表接口中的一项。
+type Item struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Page 是列表接口的一页结果，Next 非空时把它作为下一次请求的 after 参数继续翻页。
+type Page struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// list 按键的字典序分页。游标是上一页最后一个键，翻页期间有写入时结果是弱一致的，
+// 但已经返回过的键不会再次出现。
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, after := q.Get("prefix"), q.Get("after")
+	limit := defaultLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit "+strconv.Quote(s), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLimit)
+	}
+
+	// 只保留大于 after 的最小的 limit+1 个键，多出的一个用来判断是否还有下一页，
+	// 每页的内存和排序开销与 limit 成正比，而不是与整个 map 的大小成正比
+	top := make(itemHeap, 0, limit+1)
+	h.m.Range(func(k, v string) bool {
+		if !strings.HasPrefix(k, prefix) || k <= after {
+			return r.Context().Err() == nil
+		}
+		if len(top) <= limit {
+			heap.Push(&top, Item{k, v})
+		} else if k < top[0].Key {
+			top[0] = Item{k, v}
+			heap.Fix(&top, 0)
+		}
+		return r.Context().Err() == nil
+	})
+	if err := r.Context().Err(); err != nil {
+		return
+	}
+	items := []Item(top)
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	page := Page{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.Next = items[limit-1].Key
+	}
+	if page.Items == nil {
+		page.Items = []Item{}
+	}
+	writeJSON(w, page)
+}
+
+// itemHeap 是按键排序的最大堆，堆顶是目前保留的键中最大的一个。
+type itemHeap []Item
+
+func (h itemHeap) Len() int           { return len(h) }
+func (h itemHeap) Less(i, j int) bool { return h[i].Key > h[j].Key }
+func (h itemHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x any)        { *h = append(*h, x.(Item)) }
+func (h *itemHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Stats 是 /stats 的返回内容。
+type Stats struct {
+	Keys        int     `json:"keys"`
+	Revision    uint64  `json:"revision"`
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	HitRatio    float64 `json:"hit_ratio"`
+	Evictions   uint64  `json:"evictions"`
+	Expirations uint64  `json:"expirations"`
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	st := h.m.Stats()
+	writeJSON(w, Stats{
+		Keys:        h.m.Len(),
+		Revision:    h.m.Revision(),
+		Hits:        st.Hits,
+		Misses:      st.Misses,
+		HitRatio:    st.HitRatio(),
+		Evictions:   st.Evictions,
+		Expirations: st.Expirations,
+	})
+}
+
+func durationParam(r *http.Request, name string) (time.Duration, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("invalid " + name + " " + strconv.Quote(s))
+	}
+	return d, nil
+}
+
+func writeValue(w http.ResponseWriter, v string) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.WriteString(w, v)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,240 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"review/cmap"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetPutDelete(t *testing.T) {
+	m := cmap.New[string, string]()
+	h := NewHandler(m)
+
+	if rec := do(t, h, "GET", "/kv/a", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET 不存在的键 = %d", rec.Code)
+	}
+	if rec := do(t, h, "PUT", "/kv/a", "hello"); rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT = %d", rec.Code)
+	}
+	rec := do(t, h, "GET", "/kv/a", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("GET = %d %q", rec.Code, rec.Body)
+	}
+	// 键中可以带 /
+	do(t, h, "PUT", "/kv/users/1", "alice")
+	if v, _ := m.Get("users/1"); v != "alice" {
+		t.Fatalf("users/1 = %q", v)
+	}
+
+	if rec := do(t, h, "DELETE", "/kv/a", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", rec.Code)
+	}
+	if rec := do(t, h, "DELETE", "/kv/a", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("重复 DELETE = %d", rec.Code)
+	}
+	if rec := do(t, h, "POST", "/kv/a", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST = %d", rec.Code)
+	}
+}
+
+func TestPutTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := cmap.New[string, string](cmap.WithClock(func() time.Time { return now }))
+	h := NewHandler(m)
+
+	if rec := do(t, h, "PUT", "/kv/s?ttl=10s", "x"); rec.Code != http.StatusNoContent {
+		t.Fatalf("PUT = %d", rec.Code)
+	}
+	now = now.Add(10 * time.Second)
+	if _, ok := m.Get("s"); ok {
+		t.Fatal("ttl 到期后键应该失效")
+	}
+	if rec := do(t, h, "PUT", "/kv/s?ttl=abc", "x"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("非法 ttl = %d", rec.Code)
+	}
+}
+
+func TestPutTooLarge(t *testing.T) {
+	h := NewHandler(cmap.New[string, string]())
+	rec := do(t, h, "PUT", "/kv/big", strings.Repeat("x", maxValueSize+1))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("PUT = %d", rec.Code)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	m := cmap.New[string, string]()
+	for i := 0; i < 25; i++ {
+		m.Put(fmt.Sprintf("user/%02d", i), fmt.Sprint(i))
+	}
+	m.Put("other", "x")
+	h := NewHandler(m)
+
+	var keys []string
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("翻页没有结束")
+		}
+		rec := do(t, h, "GET", "/kv?prefix=user/&limit=10&after="+after, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /kv = %d", rec.Code)
+		}
+		var page Page
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range page.Items {
+			keys = append(keys, it.Key)
+		}
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+
+	if len(keys) != 25 {
+		t.Fatalf("共列出 %d 个键, want 25: %v", len(keys), keys)
+	}
+	for i, k := range keys {
+		if want := fmt.Sprintf("user/%02d", i); k != want {
+			t.Fatalf("keys[%d] = %q, want %q", i, k, want)
+		}
+	}
+
+	if rec := do(t, h, "GET", "/kv?limit=0", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("limit=0 = %d", rec.Code)
+	}
+	rec := do(t, h, "GET", "/kv?prefix=none", "")
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"items":[]}` {
+		t.Fatalf("空列表 = %s", body)
+	}
+}
+
+// 键的数量超过 maxLimit 时，limit 被截到 maxLimit，逐页翻完仍然按序且不重不漏
+func TestListPaginationBeyondMaxLimit(t *testing.T) {
+	const n = 2*maxLimit + 500
+	m := cmap.New[string, string]()
+	for i := n - 1; i >= 0; i-- {
+		m.Put(fmt.Sprintf("k%05d", i), fmt.Sprint(i))
+	}
+	h := NewHandler(m)
+
+	var keys []string
+	var sizes []int
+	after := ""
+	for {
+		rec := do(t, h, "GET", "/kv?limit=5000&after="+after, "")
+		var page Page
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(page.Items))
+		for _, it := range page.Items {
+			keys = append(keys, it.Key)
+		}
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+
+	if fmt.Sprint(sizes) != fmt.Sprint([]int{maxLimit, maxLimit, 500}) {
+		t.Fatalf("每页条数 = %v", sizes)
+	}
+	if len(keys) != n {
+		t.Fatalf("共列出 %d 个键, want %d", len(keys), n)
+	}
+	for i, k := range keys {
+		if want := fmt.Sprintf("k%05d", i); k != want {
+			t.Fatalf("keys[%d] = %q, want %q", i, k, want)
+		}
+	}
+}
+
+func TestLongPoll(t *testing.T) {
+	m := cmap.New[string, string]()
+	srv := httptest.NewServer(NewHandler(m))
+	defer srv.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Put("job", "done")
+	}()
+	resp, err := http.Get(srv.URL + "/kv/job?wait=5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "done" {
+		t.Fatalf("长轮询 = %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestLongPollTimeout(t *testing.T) {
+	h := NewHandler(cmap.New[string, string]())
+	start := time.Now()
+	rec := do(t, h, "GET", "/kv/never?wait=50ms", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("超时 = %d", rec.Code)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("应该等满 wait 再返回")
+	}
+}
+
+// 请求 ctx 先于 ?wait 结束时立即返回
+func TestLongPollRequestContext(t *testing.T) {
+	h := NewHandler(cmap.New[string, string]())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest("GET", "/kv/never?wait=1m", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("请求 ctx 结束后 handler 没有返回")
+	}
+}
+
+func TestStats(t *testing.T) {
+	m := cmap.New[string, string]()
+	h := NewHandler(m)
+	do(t, h, "PUT", "/kv/a", "1")
+	do(t, h, "GET", "/kv/a", "")
+	do(t, h, "GET", "/kv/b", "")
+
+	rec := do(t, h, "GET", "/stats", "")
+	var st Stats
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Keys != 1 || st.Hits != 1 || st.Misses != 1 || st.HitRatio != 0.5 {
+		t.Fatalf("stats = %+v", st)
+	}
+	if st.Revision != m.Revision() {
+		t.Fatalf("revision = %d, want %d", st.Revision, m.Revision())
+	}
+}
@@ -0,0 +1,113 @@
+package cmap
+
+// 以下读-改-写操作都在键所属分片的写锁内一次完成，不会和同一分片上的其他写操作交错。
+// 更新已有键时保留它原来的过期时间，新写入的键永不过期；已过期的条目视为不存在。
+
+// LoadOrStore 键存在时返回已有的值且 loaded 为 true，否则写入 v 并返回 v。
+func (m *ConcurrentMap[K, V]) LoadOrStore(k K, v V) (actual V, loaded bool) {
+	s := m.shardFor(k)
+	var evicted []kv[K, V]
+	defer func() { m.notifyEvict(evicted) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.loadLive(k, m.nowNano(), &evicted); ok {
+		actual, loaded = e.value, true
+	} else {
+		evicted = append(evicted, s.set(k, v, 0)...)
+		actual = v
+	}
+	return actual, loaded
+}
+
+// Swap 写入 v 并返回之前的值，loaded 表示之前键是否存在。
+func (m *ConcurrentMap[K, V]) Swap(k K, v V) (previous V, loaded bool) {
+	s := m.shardFor(k)
+	var evicted []kv[K, V]
+	defer func() { m.notifyEvict(evicted) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, loaded := s.loadLive(k, m.nowNano(), &evicted)
+	evicted = append(evicted, s.set(k, v, e.expireAt)...)
+	return e.value, loaded
+}
+
+// CompareAndSwap 当键存在且当前值等于 old 时替换为 new。
+// 与 sync.Map 一样，V 的动态类型不可比较时会 panic。
+func (m *ConcurrentMap[K, V]) CompareAndSwap(k K, old, new V) bool {
+	s := m.shardFor(k)
+	var evicted []kv[K, V]
+	defer func() { m.notifyEvict(evicted) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.loadLive(k, m.nowNano(), &evicted)
+	swapped := ok && any(e.value) == any(old)
+	if swapped {
+		evicted = append(evicted, s.set(k, new, e.expireAt)...)
+	}
+	return swapped
+}
+
+// CompareAndDelete 当键存在且当前值等于 old 时删除它。
+// 与 sync.Map 一样，V 的动态类型不可比较时会 panic。
+func (m *ConcurrentMap[K, V]) CompareAndDelete(k K, old V) bool {
+	s := m.shardFor(k)
+	var evicted []kv[K, V]
+	defer func() { m.notifyEvict(evicted) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.loadLive(k, m.nowNano(), &evicted)
+	deleted := ok && any(e.value) == any(old)
+	if deleted {
+		s.del(k)
+	}
+	return deleted
+}
+
+// Compute 用 fn 根据旧值计算新值：fn 返回 keep 为 false 时删除该键，否则写入新值。
+// 返回键最终的值以及是否存在。fn 在分片锁内执行，不能再访问同一个 map。
+func (m *ConcurrentMap[K, V]) Compute(k K, fn func(old V, ok bool) (V, bool)) (V, bool) {
+	s := m.shardFor(k)
+	var evicted []kv[K, V]
+	defer func() { m.notifyEvict(evicted) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.loadLive(k, m.nowNano(), &evicted)
+	v, keep := fn(e.value, ok)
+	switch {
+	case keep:
+		evicted = append(evicted, s.set(k, v, e.expireAt)...)
+	case ok:
+		s.del(k)
+	}
+	if !keep {
+		var zero V
+		return zero, false
+	}
+	return v, true
+}
+
+// loadLive 返回未过期的条目，遇到过期条目时顺手删除并追加到 expired。
+// 调用方需持有 s.mu 写锁，并在解锁后回调 expired。
+func (s *shard[K, V]) loadLive(k K, now int64, expired *[]kv[K, V]) (entry[V], bool) {
+	e, ok := s.data[k]
+	if !ok {
+		return entry[V]{}, false
+	}
+	if e.expired(now) {
+		s.del(k)
+		s.expirations.Add(1)
+		*expired = append(*expired, kv[K, V]{k, e.value})
+		return entry[V]{}, false
+	}
+	return e, true
+}
@@ -0,0 +1,167 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadOrStore(t *testing.T) {
+	m := New[string, int]()
+
+	if v, loaded := m.LoadOrStore("k", 1); loaded || v != 1 {
+		t.Fatalf("LoadOrStore = %v, %v, want 1, false", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("k", 2); !loaded || v != 1 {
+		t.Fatalf("LoadOrStore = %v, %v, want 1, true", v, loaded)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	m := New[string, int]()
+
+	if _, loaded := m.Swap("k", 1); loaded {
+		t.Fatal("键不存在时 loaded 应该为 false")
+	}
+	if prev, loaded := m.Swap("k", 2); !loaded || prev != 1 {
+		t.Fatalf("Swap = %v, %v, want 1, true", prev, loaded)
+	}
+	if v, _ := m.Get("k"); v != 2 {
+		t.Fatalf("Get = %v, want 2", v)
+	}
+}
+
+func TestCompareAndSwapDelete(t *testing.T) {
+	m := New[string, int]()
+
+	if m.CompareAndSwap("k", 0, 1) {
+		t.Fatal("键不存在时不应该交换成功")
+	}
+	m.Put("k", 1)
+	if m.CompareAndSwap("k", 2, 3) {
+		t.Fatal("旧值不匹配时不应该交换成功")
+	}
+	if !m.CompareAndSwap("k", 1, 3) {
+		t.Fatal("旧值匹配时应该交换成功")
+	}
+	if m.CompareAndDelete("k", 1) {
+		t.Fatal("旧值不匹配时不应该删除")
+	}
+	if !m.CompareAndDelete("k", 3) {
+		t.Fatal("旧值匹配时应该删除")
+	}
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("键应该已被删除")
+	}
+}
+
+func TestCompareAndSwapUncomparablePanics(t *testing.T) {
+	m := New[string, any]()
+	m.Put("k", []int{1})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("值不可比较时应该 panic")
+			}
+		}()
+		m.CompareAndSwap("k", []int{1}, []int{2})
+	}()
+
+	// panic 之后分片锁必须已经释放
+	m.Put("k", 1)
+}
+
+func TestCompute(t *testing.T) {
+	m := New[string, int]()
+
+	v, ok := m.Compute("k", func(old int, ok bool) (int, bool) {
+		if ok {
+			t.Fatal("键不存在时 ok 应该为 false")
+		}
+		return 10, true
+	})
+	if !ok || v != 10 {
+		t.Fatalf("Compute = %v, %v", v, ok)
+	}
+
+	v, ok = m.Compute("k", func(old int, ok bool) (int, bool) {
+		return old + 1, true
+	})
+	if !ok || v != 11 {
+		t.Fatalf("Compute = %v, %v", v, ok)
+	}
+
+	if _, ok = m.Compute("k", func(old int, ok bool) (int, bool) {
+		return 0, false
+	}); ok {
+		t.Fatal("keep 为 false 时应该删除")
+	}
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("键应该已被删除")
+	}
+}
+
+func TestComputeKeepsTTL(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+
+	m.PutWithTTL("k", 1, time.Minute)
+	m.Compute("k", func(old int, ok bool) (int, bool) { return old + 1, true })
+
+	clock.Advance(time.Minute)
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("Compute 更新后应该保留原来的过期时间")
+	}
+
+	// 过期的条目视为不存在
+	m.PutWithTTL("k", 1, time.Second)
+	clock.Advance(time.Second)
+	if _, loaded := m.LoadOrStore("k", 2); loaded {
+		t.Fatal("过期条目不应该被 LoadOrStore 读到")
+	}
+}
+
+// 并发递增不丢失更新
+func TestAtomicStress(t *testing.T) {
+	m := New[string, int](WithShardCount(2))
+
+	const goroutines, perG = 16, 1000
+	var wg sync.WaitGroup
+	wg.Add(goroutines * 3)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				m.Compute("compute", func(old int, ok bool) (int, bool) {
+					return old + 1, true
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				for {
+					old, _ := m.LoadOrStore("cas", 0)
+					if m.CompareAndSwap("cas", old, old+1) {
+						break
+					}
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				m.Swap("swap", i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := m.Get("compute"); v != goroutines*perG {
+		t.Fatalf("compute = %d, want %d", v, goroutines*perG)
+	}
+	if v, _ := m.Get("cas"); v != goroutines*perG {
+		t.Fatalf("cas = %d, want %d", v, goroutines*perG)
+	}
+}
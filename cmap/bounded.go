@@ -0,0 +1,102 @@
+package cmap
+
+import "time"
+
+// NewBounded 创建一个最多容纳 capacity 个条目的 ConcurrentMap，超出时由 newPolicy 创建的淘汰策略选择牺牲者。
+// 容量平均分摊到各个分片，每个分片独立淘汰；分片数多于容量时会自动减少分片数。
+// 有淘汰策略的 map 在 Get 命中时需要更新策略状态，因此 Get 会持有分片写锁而不是读锁。
+func NewBounded[K comparable, V any](capacity int, newPolicy func(capacity int) Policy[K], opts ...Option) *ConcurrentMap[K, V] {
+	if capacity <= 0 {
+		panic("cmap: NewBounded 的容量必须大于 0")
+	}
+
+	o := options{shardCount: defaultShardCount, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	n := 1
+	for n < o.shardCount {
+		n <<= 1
+	}
+	for n > capacity {
+		n >>= 1
+	}
+	o.shardCount = n
+
+	m := newMap[K, V](o)
+	for i, s := range m.shards {
+		s.capacity = capacity / n
+		if i < capacity%n {
+			s.capacity++
+		}
+		s.policy = newPolicy(s.capacity)
+	}
+	return m
+}
+
+// getTouch 是有淘汰策略时的 Get，命中需要在写锁下通知策略。
+func (m *ConcurrentMap[K, V]) getTouch(s *shard[K, V], k K, now int64) (v V, ok bool) {
+	s.mu.Lock()
+	e, ok := s.data[k]
+	if ok && !e.expired(now) {
+		s.policy.Access(k)
+		s.mu.Unlock()
+		s.hits.Add(1)
+		return e.value, true
+	}
+	s.mu.Unlock()
+
+	s.misses.Add(1)
+	if ok {
+		m.removeExpired(s, k, now)
+	}
+	return v, false
+}
+
+// evictOverflow 淘汰超出分片容量的条目，调用方需持有 s.mu 写锁。
+func (s *shard[K, V]) evictOverflow() []kv[K, V] {
+	var evicted []kv[K, V]
+	for len(s.data) > s.capacity {
+		victim, ok := s.policy.Evict()
+		if !ok {
+			break
+		}
+		e, ok := s.data[victim]
+		if !ok {
+			continue
+		}
+		s.remove(victim)
+		evicted = append(evicted, kv[K, V]{victim, e.value})
+	}
+	s.evictions.Add(uint64(len(evicted)))
+	return evicted
+}
+
+// Stats 是 map 的命中与淘汰计数。
+type Stats struct {
+	Hits        uint64 // Get 命中次数
+	Misses      uint64 // Get 未命中次数，包括读到过期条目
+	Evictions   uint64 // 因容量上限被淘汰的条目数
+	Expirations uint64 // 因过期被移除的条目数
+}
+
+// HitRatio 返回命中率，没有任何 Get 时返回 0。
+func (st Stats) HitRatio() float64 {
+	total := st.Hits + st.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(st.Hits) / float64(total)
+}
+
+// Stats 汇总各分片的计数器。
+func (m *ConcurrentMap[K, V]) Stats() Stats {
+	var st Stats
+	for _, s := range m.shards {
+		st.Hits += s.hits.Load()
+		st.Misses += s.misses.Load()
+		st.Evictions += s.evictions.Load()
+		st.Expirations += s.expirations.Load()
+	}
+	return st
+}
@@ -0,0 +1,142 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+)
+
+var policies = map[string]func(int) Policy[int]{
+	"LRU": NewLRU[int],
+	"LFU": NewLFU[int],
+	"ARC": NewARC[int],
+}
+
+func TestBoundedCapacity(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			var evicted int
+			m := NewBounded[int, int](100, newPolicy)
+			m.SetOnEvict(func(k, v int) {
+				evicted++
+			})
+
+			for i := 0; i < 1000; i++ {
+				m.Put(i, i)
+			}
+			if n := m.Len(); n != 100 {
+				t.Fatalf("Len() = %d, want 100", n)
+			}
+			st := m.Stats()
+			if st.Evictions != 900 || evicted != 900 {
+				t.Fatalf("Evictions = %d, 回调 %d 次, want 900", st.Evictions, evicted)
+			}
+		})
+	}
+}
+
+func TestBoundedSmallCapacity(t *testing.T) {
+	m := NewBounded[int, int](3, NewLRU[int])
+	if len(m.shards) != 2 {
+		t.Fatalf("分片数 = %d, 容量 3 时应该缩减到 2", len(m.shards))
+	}
+	for i := 0; i < 10; i++ {
+		m.Put(i, i)
+	}
+	if n := m.Len(); n > 3 {
+		t.Fatalf("Len() = %d, 超过容量 3", n)
+	}
+}
+
+func TestBoundedLRUKeepsHotKey(t *testing.T) {
+	m := NewBounded[int, int](2, NewLRU[int], WithShardCount(1))
+	m.Put(1, 1)
+	m.Put(2, 2)
+	m.Get(1)
+	m.Put(3, 3) // 淘汰 2
+
+	if _, ok := m.Get(2); ok {
+		t.Fatal("2 应该被淘汰")
+	}
+	if _, ok := m.Get(1); !ok {
+		t.Fatal("1 最近被访问过，不应该被淘汰")
+	}
+
+	st := m.Stats()
+	if st.Hits != 2 || st.Misses != 1 {
+		t.Fatalf("Stats = %+v", st)
+	}
+}
+
+func TestBoundedDeleteFreesSlot(t *testing.T) {
+	m := NewBounded[int, int](2, NewLFU[int], WithShardCount(1))
+	m.Put(1, 1)
+	m.Put(2, 2)
+	m.Delete(1)
+	m.Put(3, 3)
+
+	if st := m.Stats(); st.Evictions != 0 {
+		t.Fatalf("删除后还有空位，不应该淘汰, Evictions = %d", st.Evictions)
+	}
+}
+
+// 与 TestConcurrentMap 一样一边读一边写，配合 -race 运行
+func TestBoundedConcurrentGetPut(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			m := NewBounded[int, int](64, newPolicy, WithShardCount(4))
+
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(2)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 2000; i++ {
+						m.Put((g*31+i)%256, i)
+					}
+				}(g)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 2000; i++ {
+						m.Get((g*17 + i) % 256)
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			if n := m.Len(); n > 64 {
+				t.Fatalf("Len() = %d, 超过容量 64", n)
+			}
+			st := m.Stats()
+			if st.Hits+st.Misses != 8*2000 {
+				t.Fatalf("Hits+Misses = %d, want %d", st.Hits+st.Misses, 8*2000)
+			}
+		})
+	}
+}
+
+// 热点键每轮访问两次，中间穿插一次性扫描：LRU 会被扫描冲掉热点键，ARC 把热点键留在 t2 中
+func TestARCScanResistance(t *testing.T) {
+	run := func(newPolicy func(int) Policy[int]) uint64 {
+		m := NewBounded[int, int](100, newPolicy, WithShardCount(1))
+		for round := 0; round < 20; round++ {
+			for k := 0; k < 50; k++ {
+				if _, ok := m.Get(k); !ok {
+					m.Put(k, k)
+				}
+				m.Get(k)
+			}
+			for k := 0; k < 80; k++ {
+				scan := 1000 + round*80 + k
+				m.Put(scan, scan)
+			}
+		}
+		return m.Stats().Hits
+	}
+
+	lruHits := run(NewLRU[int])
+	arcHits := run(NewARC[int])
+	t.Logf("LRU hits=%d ARC hits=%d", lruHits, arcHits)
+	if arcHits <= lruHits {
+		t.Fatalf("ARC 命中 %d 次，应该多于 LRU 的 %d 次", arcHits, lruHits)
+	}
+}
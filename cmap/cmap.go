@@ -0,0 +1,342 @@
+// Package cmap 提供按分片加锁（lock striping）的泛型并发安全 map。
+package cmap
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"review/internal/keyhash"
+)
+
+const defaultShardCount = 32
+
+// ConcurrentMap 把键按哈希分散到 N 个分片，每个分片一把读写锁，
+// 不同分片上的读写互不阻塞。零值不可用，请使用 New 创建。
+type ConcurrentMap[K comparable, V any] struct {
+	shards      []*shard[K, V]
+	mask        uint64
+	seed        maphash.Seed
+	now         func() time.Time
+	onEvict     atomic.Pointer[func(K, V)]
+	negativeTTL time.Duration
+
+	// rev 是全局递增的写入版本号，每次写入或删除都会分配一个新值
+	rev       atomic.Uint64
+	history   int           // 每个键保留的历史版本数，0 表示不保留
+	compacted atomic.Uint64 // CompactHistory 回收到的版本号
+
+	watchers watchHub[K, V]
+	wal      *wal[K, V] // 只有 Open 创建的 map 才有
+
+	// repl 在有 ServeReplication 运行时安装，期间的写入都追加到其中；
+	// replServers 是运行中的 ServeReplication 数，由 replMu 保护，降到零时卸载 repl
+	repl        atomic.Pointer[replLog[K, V]]
+	replMu      sync.Mutex
+	replServers int
+	replBacklog int
+}
+
+type shard[K comparable, V any] struct {
+	m       *ConcurrentMap[K, V]
+	mu      sync.RWMutex
+	data    map[K]entry[V]
+	waiters map[K]*waitSlot[V]
+	hist    map[K]*keyHistory[V]
+	// calls 是进行中的 GetOrLoad 加载，negative 是缓存的加载失败结果
+	calls    map[K]*loadCall[V]
+	negative map[K]negEntry
+	// shared 表示 data 正被快照引用，下一次写入前要先复制一份（写时复制）
+	shared bool
+	// batch 非 nil 时 set 和 remove 把 WAL 和复制记录收集到这里而不是立即写出，
+	// 由事务提交时合成一条记录，见 Txn.Commit
+	batch *[]walRecord[K, V]
+
+	// policy 和 capacity 只在 NewBounded 创建的 map 上设置
+	policy   Policy[K]
+	capacity int
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+type entry[V any] struct {
+	value    V
+	expireAt int64  // UnixNano，0 表示永不过期
+	rev      uint64 // 写入时分配的版本号，事务提交时据此检测冲突
+}
+
+func (e entry[V]) expired(now int64) bool {
+	return e.expireAt != 0 && now >= e.expireAt
+}
+
+// Option 配置 ConcurrentMap。
+type Option func(*options)
+
+type options struct {
+	shardCount  int
+	now         func() time.Time
+	history     int
+	negativeTTL time.Duration
+	replBacklog int
+
+	fsync           FsyncPolicy
+	fsyncInterval   time.Duration
+	compactInterval time.Duration
+}
+
+// WithShardCount 设置分片数，向上取整到 2 的幂。
+func WithShardCount(n int) Option {
+	return func(o *options) {
+		o.shardCount = n
+	}
+}
+
+// New 创建一个 ConcurrentMap。
+func New[K comparable, V any](opts ...Option) *ConcurrentMap[K, V] {
+	o := options{shardCount: defaultShardCount, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return newMap[K, V](o)
+}
+
+func newMap[K comparable, V any](o options) *ConcurrentMap[K, V] {
+	n := 1
+	for n < o.shardCount {
+		n <<= 1
+	}
+
+	m := &ConcurrentMap[K, V]{
+		shards:      make([]*shard[K, V], n),
+		mask:        uint64(n - 1),
+		seed:        maphash.MakeSeed(),
+		now:         o.now,
+		negativeTTL: o.negativeTTL,
+		history:     o.history,
+		replBacklog: o.replBacklog,
+	}
+	if m.replBacklog <= 0 {
+		m.replBacklog = defaultReplBacklog
+	}
+	for i := range m.shards {
+		m.shards[i] = &shard[K, V]{m: m, data: make(map[K]entry[V])}
+	}
+	return m
+}
+
+func (m *ConcurrentMap[K, V]) shardIndex(k K) int {
+	return int(keyhash.Hash(m.seed, k) & m.mask)
+}
+
+func (m *ConcurrentMap[K, V]) shardFor(k K) *shard[K, V] {
+	return m.shards[m.shardIndex(k)]
+}
+
+func (m *ConcurrentMap[K, V]) nowNano() int64 {
+	return m.now().UnixNano()
+}
+
+// Put 写入键值对，只持有所属分片的写锁，不会阻塞等待读者。
+func (m *ConcurrentMap[K, V]) Put(k K, v V) {
+	s := m.shardFor(k)
+	s.mu.Lock()
+	evicted := s.set(k, v, 0)
+	s.mu.Unlock()
+
+	m.notifyEvict(evicted)
+}
+
+// Get 读取键对应的值，键不存在或已过期时 ok 为 false。
+// 读到过期条目时会顺手删除它（惰性过期）。
+func (m *ConcurrentMap[K, V]) Get(k K) (v V, ok bool) {
+	s := m.shardFor(k)
+	now := m.nowNano()
+	if s.policy != nil {
+		return m.getTouch(s, k, now)
+	}
+
+	s.mu.RLock()
+	e, ok := s.data[k]
+	s.mu.RUnlock()
+
+	if !ok {
+		s.misses.Add(1)
+		return v, false
+	}
+	if e.expired(now) {
+		s.misses.Add(1)
+		m.removeExpired(s, k, now)
+		return v, false
+	}
+	s.hits.Add(1)
+	return e.value, true
+}
+
+// Delete 删除键，返回键删除前是否存在。
+func (m *ConcurrentMap[K, V]) Delete(k K) bool {
+	s := m.shardFor(k)
+	now := m.nowNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[k]
+	if !ok {
+		return false
+	}
+	s.del(k)
+	return !e.expired(now)
+}
+
+// Len 返回所有分片的元素总数。各分片依次加锁统计，并发写入时只是一个近似值；
+// 已过期但尚未被清理的条目也会计算在内。
+func (m *ConcurrentMap[K, V]) Len() int {
+	n := 0
+	for _, s := range m.shards {
+		s.mu.RLock()
+		n += len(s.data)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// lookup 读取未过期的值，调用方需持有 s.mu 读锁或写锁。
+func (s *shard[K, V]) lookup(k K, now int64) (v V, ok bool) {
+	e, ok := s.data[k]
+	if !ok || e.expired(now) {
+		return v, false
+	}
+	return e.value, true
+}
+
+// set、del 和 remove 是分片内所有写操作的唯一入口，调用方需持有 s.mu 写锁。
+// 有容量上限时 set 可能淘汰其他条目，被淘汰的条目通过返回值交给调用方在锁外回调。
+// map 开启了 WAL 或复制时，set 先编码记录，超过单帧上限的写入被拒绝、不改变 map，见 ErrTooLarge。
+func (s *shard[K, V]) set(k K, v V, expireAt int64) []kv[K, V] {
+	rec := walRecord[K, V]{Op: opPut, Key: k, Value: v, ExpireAt: expireAt}
+	frame, ok := s.prepare(rec)
+	if !ok {
+		return nil
+	}
+	s.own()
+	old, exists := s.data[k]
+	rev := s.m.rev.Add(1)
+	s.data[k] = entry[V]{value: v, expireAt: expireAt, rev: rev}
+	s.wake(k, v)
+	delete(s.negative, k)
+	s.record(k, Version[V]{Rev: rev, Value: v})
+	s.log(rec, frame)
+	if s.m.watchers.active() {
+		ev := Event[K, V]{Type: EventPut, Key: k, New: v, Rev: rev}
+		if exists && !old.expired(s.m.nowNano()) {
+			ev.Old, ev.HadOld = old.value, true
+		}
+		s.m.watchers.publish(ev)
+	}
+
+	if s.policy == nil {
+		return nil
+	}
+	if exists {
+		s.policy.Access(k)
+		return nil
+	}
+	s.policy.Insert(k)
+	return s.evictOverflow()
+}
+
+func (s *shard[K, V]) del(k K) bool {
+	if _, ok := s.data[k]; !ok {
+		return false
+	}
+	if s.policy != nil {
+		s.policy.Remove(k)
+	}
+	s.remove(k)
+	return true
+}
+
+// remove 只从 data 中删除，不通知淘汰策略。
+func (s *shard[K, V]) remove(k K) {
+	s.own()
+	old := s.data[k]
+	delete(s.data, k)
+	rev := s.m.rev.Add(1)
+	s.record(k, Version[V]{Rev: rev, Deleted: true})
+	s.log(walRecord[K, V]{Op: opDelete, Key: k}, nil)
+	if s.m.watchers.active() {
+		// 与 set 一致，已经过期的旧值视为不存在
+		ev := Event[K, V]{Type: EventDelete, Key: k, Rev: rev}
+		if !old.expired(s.m.nowNano()) {
+			ev.Old, ev.HadOld = old.value, true
+		}
+		s.m.watchers.publish(ev)
+	}
+}
+
+// prepare 在写入生效之前编码它的 WAL 记录，编码失败或超过上限时记下错误并返回 false。
+// 没有 WAL 和复制时不需要编码；事务中的写入由 Txn.Commit 整体检查。调用方需持有 s.mu 写锁。
+func (s *shard[K, V]) prepare(rec walRecord[K, V]) (frame []byte, ok bool) {
+	if s.batch != nil || (s.m.wal == nil && s.m.repl.Load() == nil) {
+		return nil, true
+	}
+	frame, err := encodeRecord(rec)
+	if err != nil {
+		s.m.reject(err)
+		return nil, false
+	}
+	return frame, true
+}
+
+// log 把一次写入追加到 WAL 和复制积压缓冲区，调用方需持有 s.mu 写锁，
+// 同一个键的记录顺序与写入顺序一致。frame 是 prepare 编码好的帧，为 nil 时由 WAL 自己编码。
+func (s *shard[K, V]) log(rec walRecord[K, V], frame []byte) {
+	if s.batch != nil {
+		*s.batch = append(*s.batch, rec)
+		return
+	}
+	s.m.logRecord(rec, frame)
+}
+
+func (m *ConcurrentMap[K, V]) logRecord(rec walRecord[K, V], frame []byte) {
+	if m.wal != nil {
+		if frame == nil {
+			m.wal.append(rec)
+		} else {
+			m.wal.appendFrame(frame)
+		}
+	}
+	if l := m.repl.Load(); l != nil {
+		l.append(rec)
+	}
+}
+
+// reject 记录一次因无法编码或超过单帧上限而被拒绝的写入，持久化的 map 由 Sync 和 Close 返回这个错误。
+func (m *ConcurrentMap[K, V]) reject(err error) {
+	if m.wal == nil {
+		return
+	}
+	m.wal.mu.Lock()
+	defer m.wal.mu.Unlock()
+	if m.wal.rejected == nil {
+		m.wal.rejected = err
+	}
+}
+
+type kv[K comparable, V any] struct {
+	k K
+	v V
+}
+
+func (m *ConcurrentMap[K, V]) notifyEvict(evicted []kv[K, V]) {
+	fn := m.onEvict.Load()
+	if fn == nil {
+		return
+	}
+	for _, e := range evicted {
+		(*fn)(e.k, e.v)
+	}
+}
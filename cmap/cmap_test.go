@@ -0,0 +1,146 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPutGetDelete(t *testing.T) {
+	m := New[string, int]()
+
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("空 map 不应该读到值")
+	}
+
+	m.Put("a", 1)
+	m.Put("b", 2)
+	m.Put("a", 3) // 覆盖
+
+	if v, ok := m.Get("a"); !ok || v != 3 {
+		t.Fatalf("Get(a) = %v, %v, want 3, true", v, ok)
+	}
+	if n := m.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+
+	if !m.Delete("a") {
+		t.Fatal("Delete(a) 应该返回 true")
+	}
+	if m.Delete("a") {
+		t.Fatal("重复 Delete(a) 应该返回 false")
+	}
+	if n := m.Len(); n != 1 {
+		t.Fatalf("Len() = %d, want 1", n)
+	}
+}
+
+// 没有任何读者时 Put 也必须立即返回，旧实现会永久阻塞在 readCh 上
+func TestPutWithoutReader(t *testing.T) {
+	m := New[int, int]()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m.Put(i, i*i)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put 在没有读者时阻塞")
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(i); !ok || v != i*i {
+			t.Fatalf("Get(%d) = %v, %v", i, v, ok)
+		}
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	m := New[int, int](WithShardCount(5))
+	if len(m.shards) != 8 {
+		t.Fatalf("分片数 = %d, want 8", len(m.shards))
+	}
+}
+
+type point struct {
+	x, y int
+}
+
+func TestStructAndFloatKeys(t *testing.T) {
+	pm := New[point, string]()
+	pm.Put(point{1, 2}, "a")
+	if v, ok := pm.Get(point{1, 2}); !ok || v != "a" {
+		t.Fatalf("Get(point) = %v, %v", v, ok)
+	}
+
+	fm := New[float64, int]()
+	negZero := 0.0
+	negZero = -negZero
+	fm.Put(negZero, 1)
+	if v, ok := fm.Get(0); !ok || v != 1 {
+		t.Fatalf("-0 和 +0 应该是同一个键, got %v, %v", v, ok)
+	}
+
+	type fk struct{ f float64 }
+	sm := New[fk, int]()
+	sm.Put(fk{negZero}, 1)
+	if v, ok := sm.Get(fk{0}); !ok || v != 1 {
+		t.Fatalf("字段为 -0 和 +0 的结构体应该是同一个键, got %v, %v", v, ok)
+	}
+}
+
+// 指针键按身份哈希，Put 之后修改所指向的内容不影响查找
+func TestPointerKeys(t *testing.T) {
+	type node struct{ N int }
+	m := New[*node, int]()
+	var nodes []*node
+	for i := 0; i < 100; i++ {
+		p := &node{N: i}
+		nodes = append(nodes, p)
+		m.Put(p, i)
+	}
+	for _, p := range nodes {
+		p.N += 1000
+	}
+	for i, p := range nodes {
+		if v, ok := m.Get(p); !ok || v != i {
+			t.Fatalf("修改内容后 Get(nodes[%d]) = %v, %v", i, v, ok)
+		}
+	}
+	if _, ok := m.Get(&node{N: 1000}); ok {
+		t.Fatal("内容相同的另一个指针不是同一个键")
+	}
+}
+
+func TestConcurrentPutGet(t *testing.T) {
+	m := New[int, int](WithShardCount(4))
+
+	const writers, perWriter = 8, 1000
+	var wg sync.WaitGroup
+	wg.Add(writers * 2)
+	for w := 0; w < writers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				m.Put(w*perWriter+i, i)
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				m.Get(w*perWriter + i)
+				m.Len()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if n := m.Len(); n != writers*perWriter {
+		t.Fatalf("Len() = %d, want %d", n, writers*perWriter)
+	}
+}
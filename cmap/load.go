@@ -0,0 +1,113 @@
+package cmap
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Loader 在键不存在时加载它的值。
+type Loader[K comparable, V any] func(ctx context.Context, k K) (V, error)
+
+// WithNegativeTTL 让 GetOrLoad 把加载失败的结果缓存 d 时间，期间同一个键直接返回缓存的错误而不再调用 loader。
+func WithNegativeTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = d
+	}
+}
+
+// loadCall 是一次正在进行的加载，同一个键的并发 GetOrLoad 共享它的结果。
+type loadCall[V any] struct {
+	done chan struct{}
+	v    V
+	err  error
+}
+
+type negEntry struct {
+	err      error
+	expireAt int64
+}
+
+// GetOrLoad 返回键的值，键不存在时调用 loader 加载并写入 map。
+// 同一个键的并发未命中只会调用一次 loader，所有调用方共享它的结果或错误。
+// 调用方的 ctx 被取消只会让该调用方停止等待，不会取消正在进行的加载：
+// loader 收到的 ctx 保留调用方的值但不会被取消，加载完成后结果照常写入 map。
+// 加载期间如果键被其他 goroutine 写入，以已写入的值为准。
+func (m *ConcurrentMap[K, V]) GetOrLoad(ctx context.Context, k K, loader Loader[K, V]) (V, error) {
+	if v, ok := m.Get(k); ok {
+		return v, nil
+	}
+
+	s := m.shardFor(k)
+	now := m.nowNano()
+	s.mu.Lock()
+	if v, ok := s.lookup(k, now); ok {
+		s.mu.Unlock()
+		return v, nil
+	}
+	if ne, ok := s.negative[k]; ok {
+		if now < ne.expireAt {
+			s.mu.Unlock()
+			var zero V
+			return zero, ne.err
+		}
+		delete(s.negative, k)
+	}
+	if s.calls == nil {
+		s.calls = make(map[K]*loadCall[V])
+	}
+	c, ok := s.calls[k]
+	if !ok {
+		c = &loadCall[V]{done: make(chan struct{})}
+		s.calls[k] = c
+		go m.load(context.WithoutCancel(ctx), s, k, c, loader)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.v, c.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (m *ConcurrentMap[K, V]) load(ctx context.Context, s *shard[K, V], k K, c *loadCall[V], loader Loader[K, V]) {
+	v, err := callLoader(ctx, k, loader)
+
+	var evicted []kv[K, V]
+	now := m.nowNano()
+	s.mu.Lock()
+	delete(s.calls, k)
+	switch {
+	case err != nil:
+		if m.negativeTTL > 0 {
+			if s.negative == nil {
+				s.negative = make(map[K]negEntry)
+			}
+			s.negative[k] = negEntry{err: err, expireAt: now + int64(m.negativeTTL)}
+		}
+	default:
+		if cur, ok := s.loadLive(k, now, &evicted); ok {
+			v = cur.value
+		} else {
+			evicted = append(evicted, s.set(k, v, 0)...)
+		}
+	}
+	c.v, c.err = v, err
+	close(c.done)
+	s.mu.Unlock()
+
+	m.notifyEvict(evicted)
+}
+
+// callLoader 把 loader 的 panic 转成错误，避免等待者永远阻塞。
+func callLoader[K comparable, V any](ctx context.Context, k K, loader Loader[K, V]) (v V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cmap: loader panic: %v", r)
+		}
+	}()
+	return loader(ctx, k)
+}
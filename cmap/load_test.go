@@ -0,0 +1,182 @@
+package cmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 并发未命中同一个键只调用一次 loader
+func TestGetOrLoadDedup(t *testing.T) {
+	m := New[string, int]()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, k string) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 100
+	var wg sync.WaitGroup
+	results := make(chan int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := m.GetOrLoad(context.Background(), "k", loader)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond) // 让调用方都进入等待
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader 被调用 %d 次, want 1", n)
+	}
+	for v := range results {
+		if v != 42 {
+			t.Fatalf("v = %d, want 42", v)
+		}
+	}
+	if v, ok := m.Get("k"); !ok || v != 42 {
+		t.Fatal("加载结果应该写入 map")
+	}
+}
+
+func TestGetOrLoadSharedError(t *testing.T) {
+	m := New[string, int]()
+	wantErr := errors.New("db down")
+
+	var calls atomic.Int32
+	loader := func(ctx context.Context, k string) (int, error) {
+		calls.Add(1)
+		return 0, wantErr
+	}
+
+	if _, err := m.GetOrLoad(context.Background(), "k", loader); err != wantErr {
+		t.Fatalf("err = %v", err)
+	}
+	// 没有开启负缓存，失败后下一次会重新加载
+	m.GetOrLoad(context.Background(), "k", loader)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("loader 被调用 %d 次, want 2", n)
+	}
+	if _, ok := m.Get("k"); ok {
+		t.Fatal("失败的结果不应该写入 map")
+	}
+}
+
+func TestGetOrLoadNegativeTTL(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now), WithNegativeTTL(time.Minute))
+	notFound := errors.New("not found")
+
+	var calls atomic.Int32
+	loader := func(ctx context.Context, k string) (int, error) {
+		if calls.Add(1) == 1 {
+			return 0, notFound
+		}
+		return 7, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := m.GetOrLoad(context.Background(), "k", loader); err != notFound {
+			t.Fatalf("err = %v, want 缓存的 notFound", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("负缓存期间 loader 被调用 %d 次, want 1", n)
+	}
+
+	clock.Advance(time.Minute)
+	if v, err := m.GetOrLoad(context.Background(), "k", loader); err != nil || v != 7 {
+		t.Fatalf("负缓存过期后 = %v, %v", v, err)
+	}
+}
+
+func TestGetOrLoadPutClearsNegative(t *testing.T) {
+	m := New[string, int](WithNegativeTTL(time.Hour))
+	loader := func(ctx context.Context, k string) (int, error) {
+		return 0, errors.New("boom")
+	}
+
+	m.GetOrLoad(context.Background(), "k", loader)
+	m.Put("k", 1)
+	m.Delete("k")
+	if _, err := m.GetOrLoad(context.Background(), "k", func(ctx context.Context, k string) (int, error) {
+		return 2, nil
+	}); err != nil {
+		t.Fatalf("写入后负缓存应该失效, err = %v", err)
+	}
+}
+
+// 一个调用方取消只影响它自己，加载继续进行并交给其他等待者
+func TestGetOrLoadCancelDoesNotCancelLoad(t *testing.T) {
+	m := New[string, int]()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, k string) (int, error) {
+		close(started)
+		<-release
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 1, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := m.GetOrLoad(ctx, "k", loader)
+		cancelled <- err
+	}()
+	<-started
+
+	other := make(chan int)
+	go func() {
+		v, _ := m.GetOrLoad(context.Background(), "k", loader)
+		other <- v
+	}()
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-other; v != 1 {
+		t.Fatalf("其他等待者拿到 %d, want 1", v)
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	m := New[string, int]()
+	_, err := m.GetOrLoad(context.Background(), "k", func(ctx context.Context, k string) (int, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("loader panic 应该转成错误")
+	}
+}
+
+func TestGetOrLoadKeepsConcurrentPut(t *testing.T) {
+	m := New[string, int]()
+	v, err := m.GetOrLoad(context.Background(), "k", func(ctx context.Context, k string) (int, error) {
+		m.Put(k, 100) // 加载期间被其他写入抢先
+		return 1, nil
+	})
+	if err != nil || v != 100 {
+		t.Fatalf("GetOrLoad = %v, %v, 应该以已写入的值为准", v, err)
+	}
+}
@@ -0,0 +1,157 @@
+package cmap
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrCompacted 表示请求的版本已经被 CompactHistory 回收，或超出了每个键保留的历史条数。
+var ErrCompacted = errors.New("cmap: 请求的版本已被压缩")
+
+// ErrFutureRev 表示请求的版本比当前版本还新。
+var ErrFutureRev = errors.New("cmap: 请求的版本尚未产生")
+
+// ErrNoHistory 表示 map 没有通过 WithHistory 开启历史版本。
+var ErrNoHistory = errors.New("cmap: map 没有开启历史版本")
+
+// WithHistory 为每个键保留最近 n 个版本（包括删除），开启 GetAt 和 History。
+// 被删除的键也会保留历史，直到 CompactHistory 把它回收。
+// 版本号只在进程内有意义，通过 Open 恢复的 map 会重新编号。
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.history = n
+	}
+}
+
+// Version 是键的一个历史版本。
+type Version[V any] struct {
+	Rev     uint64
+	Value   V
+	Deleted bool
+}
+
+// keyHistory 按版本号升序保存一个键的历史。floor 之前的状态已经不可知：
+// 更早的版本要么因超出条数上限被丢弃，要么被 CompactHistory 回收。
+type keyHistory[V any] struct {
+	versions []Version[V]
+	floor    uint64
+}
+
+// Revision 返回当前的全局版本号，即最近一次写入或删除分配的版本号。
+func (m *ConcurrentMap[K, V]) Revision() uint64 {
+	return m.rev.Load()
+}
+
+// GetAt 读取键在版本 rev 时的值。
+func (m *ConcurrentMap[K, V]) GetAt(k K, rev uint64) (v V, ok bool, err error) {
+	if m.history == 0 {
+		return v, false, ErrNoHistory
+	}
+	if rev > m.rev.Load() {
+		return v, false, ErrFutureRev
+	}
+	if rev < m.compacted.Load() {
+		return v, false, ErrCompacted
+	}
+
+	s := m.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h := s.hist[k]
+	if h == nil {
+		return v, false, nil
+	}
+	i := sort.Search(len(h.versions), func(i int) bool { return h.versions[i].Rev > rev })
+	if i == 0 {
+		if rev < h.floor {
+			return v, false, ErrCompacted
+		}
+		return v, false, nil
+	}
+	ver := h.versions[i-1]
+	if ver.Deleted {
+		return v, false, nil
+	}
+	return ver.Value, true, nil
+}
+
+// History 返回键保留的所有历史版本，按版本号升序排列。
+func (m *ConcurrentMap[K, V]) History(k K) ([]Version[V], error) {
+	if m.history == 0 {
+		return nil, ErrNoHistory
+	}
+
+	s := m.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h := s.hist[k]
+	if h == nil {
+		return nil, nil
+	}
+	return append([]Version[V](nil), h.versions...), nil
+}
+
+// CompactHistory 回收版本号小于 rev 的历史：每个键只保留 rev 时刻仍然有效的那个版本及之后的版本，
+// 只剩删除记录的键被整个回收。之后 GetAt 查询小于 rev 的版本返回 ErrCompacted。
+func (m *ConcurrentMap[K, V]) CompactHistory(rev uint64) error {
+	if m.history == 0 {
+		return ErrNoHistory
+	}
+	if rev > m.rev.Load() {
+		return ErrFutureRev
+	}
+
+	for {
+		cur := m.compacted.Load()
+		if rev <= cur {
+			return nil
+		}
+		if m.compacted.CompareAndSwap(cur, rev) {
+			break
+		}
+	}
+
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for k, h := range s.hist {
+			i := sort.Search(len(h.versions), func(i int) bool { return h.versions[i].Rev > rev })
+			if i > 0 {
+				if h.versions[i-1].Deleted {
+					// rev 时刻键已经被删除，删除记录本身也不再需要
+					h.versions = h.versions[i:]
+				} else {
+					h.versions = h.versions[i-1:]
+				}
+			}
+			h.floor = max(h.floor, rev)
+			if len(h.versions) == 0 {
+				delete(s.hist, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// record 追加一个历史版本，超出条数上限时丢弃最旧的，调用方需持有 s.mu 写锁。
+func (s *shard[K, V]) record(k K, ver Version[V]) {
+	limit := s.m.history
+	if limit == 0 {
+		return
+	}
+	if s.hist == nil {
+		s.hist = make(map[K]*keyHistory[V])
+	}
+	h := s.hist[k]
+	if h == nil {
+		h = &keyHistory[V]{}
+		s.hist[k] = h
+	}
+	h.versions = append(h.versions, ver)
+	if len(h.versions) > limit {
+		h.versions = append(h.versions[:0], h.versions[len(h.versions)-limit:]...)
+		h.floor = h.versions[0].Rev
+	}
+}
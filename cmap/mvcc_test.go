@@ -0,0 +1,134 @@
+package cmap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func expectAt(t *testing.T, m *ConcurrentMap[string, int], k string, rev uint64, want int, wantOK bool) {
+	t.Helper()
+	v, ok, err := m.GetAt(k, rev)
+	if err != nil {
+		t.Fatalf("GetAt(%q, %d) err = %v", k, rev, err)
+	}
+	if ok != wantOK || (ok && v != want) {
+		t.Fatalf("GetAt(%q, %d) = %v, %v, want %v, %v", k, rev, v, ok, want, wantOK)
+	}
+}
+
+func TestGetAt(t *testing.T) {
+	m := New[string, int](WithHistory(10))
+
+	m.Put("a", 1) // rev 1
+	m.Put("b", 1) // rev 2
+	m.Put("a", 2) // rev 3
+	m.Delete("a") // rev 4
+	m.Put("a", 3) // rev 5
+
+	if rev := m.Revision(); rev != 5 {
+		t.Fatalf("Revision() = %d, want 5", rev)
+	}
+	expectAt(t, m, "a", 0, 0, false)
+	expectAt(t, m, "a", 1, 1, true)
+	expectAt(t, m, "a", 2, 1, true)
+	expectAt(t, m, "a", 3, 2, true)
+	expectAt(t, m, "a", 4, 0, false)
+	expectAt(t, m, "a", 5, 3, true)
+	expectAt(t, m, "b", 1, 0, false)
+	expectAt(t, m, "b", 5, 1, true)
+
+	if _, _, err := m.GetAt("a", 6); !errors.Is(err, ErrFutureRev) {
+		t.Fatalf("err = %v, want ErrFutureRev", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	m := New[string, int](WithHistory(3))
+	for i := 1; i <= 5; i++ {
+		m.Put("k", i)
+	}
+
+	hist, err := m.History("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 3 || hist[0].Value != 3 || hist[2].Value != 5 {
+		t.Fatalf("History = %+v", hist)
+	}
+
+	// 超出保留条数的版本不可再查询
+	if _, _, err := m.GetAt("k", 1); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("err = %v, want ErrCompacted", err)
+	}
+	expectAt(t, m, "k", 3, 3, true)
+}
+
+func TestCompactHistory(t *testing.T) {
+	m := New[string, int](WithHistory(10))
+	m.Put("a", 1)    // rev 1
+	m.Put("a", 2)    // rev 2
+	m.Put("gone", 1) // rev 3
+	m.Delete("gone") // rev 4
+	m.Put("a", 3)    // rev 5
+
+	if err := m.CompactHistory(4); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.GetAt("a", 1); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("err = %v, want ErrCompacted", err)
+	}
+	// rev 4 时刻 a 的值仍然可以读到
+	expectAt(t, m, "a", 4, 2, true)
+	expectAt(t, m, "a", 5, 3, true)
+	expectAt(t, m, "gone", 4, 0, false)
+
+	hist, _ := m.History("a")
+	if len(hist) != 2 {
+		t.Fatalf("压缩后 History(a) = %+v", hist)
+	}
+	if hist, _ := m.History("gone"); hist != nil {
+		t.Fatalf("只剩删除记录的键应该被回收, got %+v", hist)
+	}
+	if err := m.CompactHistory(100); !errors.Is(err, ErrFutureRev) {
+		t.Fatalf("err = %v, want ErrFutureRev", err)
+	}
+}
+
+func TestNoHistory(t *testing.T) {
+	m := New[string, int]()
+	m.Put("a", 1)
+	if _, _, err := m.GetAt("a", 1); !errors.Is(err, ErrNoHistory) {
+		t.Fatalf("err = %v, want ErrNoHistory", err)
+	}
+}
+
+// 并发写入时每个键的历史版本号严格递增，且每个版本都能按版本号读回
+func TestHistoryConcurrent(t *testing.T) {
+	m := New[int, int](WithHistory(1000), WithShardCount(4))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				m.Put(i%10, g*1000+i)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for k := 0; k < 10; k++ {
+		hist, _ := m.History(k)
+		for i, ver := range hist {
+			if i > 0 && ver.Rev <= hist[i-1].Rev {
+				t.Fatalf("键 %d 的版本号不递增: %+v", k, hist)
+			}
+			v, ok, err := m.GetAt(k, ver.Rev)
+			if err != nil || !ok || v != ver.Value {
+				t.Fatalf("GetAt(%d, %d) = %v, %v, %v, want %v", k, ver.Rev, v, ok, err, ver.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package cmap
+
+import "container/list"
+
+// Policy 是可插拔的淘汰策略，记录键的访问情况并在容量不足时选出牺牲者。
+// 每个分片持有一个独立的实例，所有方法都在分片写锁下调用，实现无需自己加锁。
+type Policy[K comparable] interface {
+	// Insert 记录一个新写入的键。
+	Insert(k K)
+	// Access 记录一次对已有键的读或覆盖写。
+	Access(k K)
+	// Remove 键被显式删除或过期，策略应忘掉它。
+	Remove(k K)
+	// Evict 选出一个牺牲者并从策略中移除，没有可淘汰的键时 ok 为 false。
+	Evict() (k K, ok bool)
+}
+
+// lru 最近最少使用：链表头部是最近访问的键，淘汰尾部。
+type lru[K comparable] struct {
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+// NewLRU 创建 LRU 淘汰策略，可直接作为 NewBounded 的 newPolicy 参数。
+func NewLRU[K comparable](capacity int) Policy[K] {
+	return &lru[K]{
+		ll:    list.New(),
+		items: make(map[K]*list.Element, capacity),
+	}
+}
+
+func (p *lru[K]) Insert(k K) {
+	if el, ok := p.items[k]; ok {
+		p.ll.MoveToFront(el)
+		return
+	}
+	p.items[k] = p.ll.PushFront(k)
+}
+
+func (p *lru[K]) Access(k K) {
+	if el, ok := p.items[k]; ok {
+		p.ll.MoveToFront(el)
+	}
+}
+
+func (p *lru[K]) Remove(k K) {
+	if el, ok := p.items[k]; ok {
+		p.ll.Remove(el)
+		delete(p.items, k)
+	}
+}
+
+func (p *lru[K]) Evict() (k K, ok bool) {
+	el := p.ll.Back()
+	if el == nil {
+		return k, false
+	}
+	k = p.ll.Remove(el).(K)
+	delete(p.items, k)
+	return k, true
+}
+
+// lfu 最不经常使用：按访问次数分桶，淘汰次数最少的桶里最久未访问的键，各操作均为 O(1)。
+type lfu[K comparable] struct {
+	items   map[K]*list.Element
+	buckets map[int]*list.List
+	minFreq int
+}
+
+type lfuItem[K comparable] struct {
+	key  K
+	freq int
+}
+
+// NewLFU 创建 LFU 淘汰策略，可直接作为 NewBounded 的 newPolicy 参数。
+func NewLFU[K comparable](capacity int) Policy[K] {
+	return &lfu[K]{
+		items:   make(map[K]*list.Element, capacity),
+		buckets: make(map[int]*list.List),
+	}
+}
+
+func (p *lfu[K]) bucket(freq int) *list.List {
+	b, ok := p.buckets[freq]
+	if !ok {
+		b = list.New()
+		p.buckets[freq] = b
+	}
+	return b
+}
+
+func (p *lfu[K]) Insert(k K) {
+	if _, ok := p.items[k]; ok {
+		p.Access(k)
+		return
+	}
+	p.items[k] = p.bucket(1).PushFront(&lfuItem[K]{key: k, freq: 1})
+	p.minFreq = 1
+}
+
+func (p *lfu[K]) Access(k K) {
+	el, ok := p.items[k]
+	if !ok {
+		return
+	}
+	it := el.Value.(*lfuItem[K])
+	p.unlink(el, it.freq)
+	if p.minFreq == it.freq && p.buckets[it.freq] == nil {
+		p.minFreq++
+	}
+	it.freq++
+	p.items[k] = p.bucket(it.freq).PushFront(it)
+}
+
+func (p *lfu[K]) Remove(k K) {
+	el, ok := p.items[k]
+	if !ok {
+		return
+	}
+	p.unlink(el, el.Value.(*lfuItem[K]).freq)
+	delete(p.items, k)
+	// minFreq 可能失效，留到 Evict 时再修正
+}
+
+func (p *lfu[K]) Evict() (k K, ok bool) {
+	if len(p.items) == 0 {
+		return k, false
+	}
+	b := p.buckets[p.minFreq]
+	for b == nil {
+		p.minFreq++
+		b = p.buckets[p.minFreq]
+	}
+	el := b.Back()
+	it := el.Value.(*lfuItem[K])
+	p.unlink(el, it.freq)
+	delete(p.items, it.key)
+	return it.key, true
+}
+
+// unlink 把元素移出所在的桶，桶空了就删掉。
+func (p *lfu[K]) unlink(el *list.Element, freq int) {
+	b := p.buckets[freq]
+	b.Remove(el)
+	if b.Len() == 0 {
+		delete(p.buckets, freq)
+	}
+}
+
+// arc 自适应替换缓存（Adaptive Replacement Cache）：
+// t1 存只访问过一次的键，t2 存访问过多次的键，b1/b2 是它们被淘汰后的“幽灵”记录。
+// 幽灵命中说明对应的一侧被淘汰得太早，据此调整 t1 的目标大小 p。
+type arc[K comparable] struct {
+	c              int
+	p              int
+	t1, t2, b1, b2 *arcList[K]
+}
+
+// NewARC 创建 ARC 淘汰策略，可直接作为 NewBounded 的 newPolicy 参数。
+// 对一次性的大范围扫描比 LRU 更有抵抗力。
+func NewARC[K comparable](capacity int) Policy[K] {
+	return &arc[K]{
+		c:  capacity,
+		t1: newARCList[K](),
+		t2: newARCList[K](),
+		b1: newARCList[K](),
+		b2: newARCList[K](),
+	}
+}
+
+func (p *arc[K]) Insert(k K) {
+	switch {
+	case p.t1.has(k) || p.t2.has(k):
+		p.Access(k)
+		return
+	case p.b1.has(k):
+		p.p = min(p.c, p.p+max(p.b2.len()/p.b1.len(), 1))
+		p.b1.remove(k)
+		p.t2.pushFront(k)
+		return
+	case p.b2.has(k):
+		p.p = max(0, p.p-max(p.b1.len()/p.b2.len(), 1))
+		p.b2.remove(k)
+		p.t2.pushFront(k)
+		return
+	}
+
+	p.t1.pushFront(k)
+	// 幽灵记录不超过 c 个，整体不超过 2c 个
+	if p.t1.len()+p.b1.len() > p.c && p.b1.len() > 0 {
+		p.b1.popBack()
+	}
+	if p.t1.len()+p.t2.len()+p.b1.len()+p.b2.len() > 2*p.c && p.b2.len() > 0 {
+		p.b2.popBack()
+	}
+}
+
+func (p *arc[K]) Access(k K) {
+	if p.t1.remove(k) || p.t2.remove(k) {
+		p.t2.pushFront(k)
+	}
+}
+
+func (p *arc[K]) Remove(k K) {
+	if !p.t1.remove(k) {
+		p.t2.remove(k)
+	}
+}
+
+func (p *arc[K]) Evict() (k K, ok bool) {
+	if p.t1.len() > 0 && (p.t1.len() > p.p || p.t2.len() == 0) {
+		k, _ = p.t1.popBack()
+		p.b1.pushFront(k)
+		return k, true
+	}
+	if p.t2.len() > 0 {
+		k, _ = p.t2.popBack()
+		p.b2.pushFront(k)
+		return k, true
+	}
+	return k, false
+}
+
+type arcList[K comparable] struct {
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+func newARCList[K comparable]() *arcList[K] {
+	return &arcList[K]{ll: list.New(), items: make(map[K]*list.Element)}
+}
+
+func (l *arcList[K]) len() int      { return l.ll.Len() }
+func (l *arcList[K]) has(k K) bool  { _, ok := l.items[k]; return ok }
+func (l *arcList[K]) pushFront(k K) { l.items[k] = l.ll.PushFront(k) }
+
+func (l *arcList[K]) remove(k K) bool {
+	el, ok := l.items[k]
+	if !ok {
+		return false
+	}
+	l.ll.Remove(el)
+	delete(l.items, k)
+	return true
+}
+
+func (l *arcList[K]) popBack() (k K, ok bool) {
+	el := l.ll.Back()
+	if el == nil {
+		return k, false
+	}
+	k = l.ll.Remove(el).(K)
+	delete(l.items, k)
+	return k, true
+}
@@ -0,0 +1,96 @@
+package cmap
+
+import "testing"
+
+func evictAll[K comparable](p Policy[K]) []K {
+	var keys []K
+	for {
+		k, ok := p.Evict()
+		if !ok {
+			return keys
+		}
+		keys = append(keys, k)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	p := NewLRU[int](3)
+	p.Insert(1)
+	p.Insert(2)
+	p.Insert(3)
+	p.Access(1) // 1 变成最近访问
+
+	got := evictAll(p)
+	want := []int{2, 3, 1}
+	if len(got) != len(want) {
+		t.Fatalf("evict = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("evict = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLFU(t *testing.T) {
+	p := NewLFU[string](3)
+	p.Insert("a")
+	p.Insert("b")
+	p.Insert("c")
+	p.Access("a")
+	p.Access("a")
+	p.Access("c")
+
+	// b 访问 1 次，c 2 次，a 3 次
+	if k, _ := p.Evict(); k != "b" {
+		t.Fatalf("第一个淘汰 %q, want b", k)
+	}
+	p.Remove("c")
+	if k, _ := p.Evict(); k != "a" {
+		t.Fatalf("删除 c 后淘汰 %q, want a", k)
+	}
+	if _, ok := p.Evict(); ok {
+		t.Fatal("空策略不应该再淘汰")
+	}
+}
+
+func TestLFUTieBreaksByRecency(t *testing.T) {
+	p := NewLFU[int](3)
+	p.Insert(1)
+	p.Insert(2)
+	p.Insert(3)
+
+	if k, _ := p.Evict(); k != 1 {
+		t.Fatalf("访问次数相同时应淘汰最早的, got %d", k)
+	}
+}
+
+func TestARCGhostHitPromotes(t *testing.T) {
+	p := NewARC[int](2).(*arc[int])
+	p.Insert(1)
+	p.Insert(2)
+	if k, _ := p.Evict(); k != 1 {
+		t.Fatalf("淘汰 %d, want 1", k)
+	}
+	if !p.b1.has(1) {
+		t.Fatal("被淘汰的键应该留在 b1 幽灵列表中")
+	}
+
+	// 幽灵命中：1 重新写入后直接进入 t2，同时增大 t1 的目标大小
+	p.Insert(1)
+	if !p.t2.has(1) || p.p == 0 {
+		t.Fatalf("幽灵命中后 t2.has(1)=%v p=%d", p.t2.has(1), p.p)
+	}
+}
+
+func TestARCRemove(t *testing.T) {
+	p := NewARC[int](2)
+	p.Insert(1)
+	p.Access(1)
+	p.Insert(2)
+	p.Remove(1)
+	p.Remove(2)
+	if _, ok := p.Evict(); ok {
+		t.Fatal("删除所有键后不应该再淘汰")
+	}
+}
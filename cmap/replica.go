@@ -0,0 +1,548 @@
+package cmap
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 复制协议沿用 WAL 的帧格式。副本连上后先发一帧 hello（上次同步到的复制 ID 和偏移），
+// 主节点在积压缓冲区还能覆盖这个偏移时回复 continue 帧并从偏移之后继续推送；
+// 否则做全量同步：snapshot-begin 帧、快照中的每个 put 帧、snapshot-end 帧，然后推送快照之后的写入。
+// 偏移是主节点写入的序号，与版本号不同，它按追加到积压缓冲区的顺序严格连续。
+// 副本每处理完一批帧回复一个 ack 帧，主节点据此计算每个副本的延迟。
+// 积压缓冲区只在有 ServeReplication 运行时存在，全部返回后卸载，之后的写入不再为复制付出开销；
+// 再次调用 ServeReplication 时换用新的复制 ID，副本会重新全量同步。
+
+const (
+	opContinue byte = opBatch + 1 + iota
+	opPing
+	opAck
+)
+
+const (
+	defaultReplBacklog = 10000
+	replBatch          = 1024
+)
+
+// replPingInterval 是主节点空闲时发送心跳的间隔，副本超过三个间隔没有收到任何帧就重连。
+var replPingInterval = time.Second
+
+// errReplicaBehind 表示副本落后太多，需要的记录已经被挤出积压缓冲区，断开后它会重新全量同步。
+var errReplicaBehind = errors.New("cmap: 副本落后超出积压缓冲区")
+
+// WithReplBacklog 设置主节点为断线重连的副本保留的最近写入条数，默认 10000。
+// 副本断开期间的写入超过这个数量时，重连后需要全量同步。
+func WithReplBacklog(n int) Option {
+	return func(o *options) {
+		o.replBacklog = n
+	}
+}
+
+type replRecord[K comparable, V any] struct {
+	walRecord[K, V]
+	Seq uint64 `json:"q,omitempty"`
+	ID  string `json:"id,omitempty"`
+}
+
+// replLog 是主节点的复制积压缓冲区：一个按偏移寻址的环形缓冲区。
+// 写入者在持有分片锁时追加，同一个键的记录顺序与写入顺序一致。
+type replLog[K comparable, V any] struct {
+	id string
+
+	mu       sync.Mutex
+	buf      []walRecord[K, V]
+	next     uint64 // 已追加的记录数，也是最新记录的偏移
+	replicas map[*replicaConn]struct{}
+	// notify 在有推送者等待新记录时才由 since 创建，下一次追加时关闭并置空，
+	// 所以不会每次写入都分配一个 channel
+	notify chan struct{}
+}
+
+type replicaConn struct {
+	addr  string
+	acked atomic.Uint64
+}
+
+func newReplLog[K comparable, V any](size int) *replLog[K, V] {
+	var b [20]byte
+	rand.Read(b[:])
+	return &replLog[K, V]{
+		id:       hex.EncodeToString(b[:]),
+		buf:      make([]walRecord[K, V], size),
+		replicas: make(map[*replicaConn]struct{}),
+	}
+}
+
+func (l *replLog[K, V]) append(rec walRecord[K, V]) {
+	l.mu.Lock()
+	l.next++
+	l.buf[(l.next-1)%uint64(len(l.buf))] = rec
+	if l.notify != nil {
+		close(l.notify)
+		l.notify = nil
+	}
+	l.mu.Unlock()
+}
+
+func (l *replLog[K, V]) offset() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next
+}
+
+// since 返回偏移 off 之后的一批记录。没有新记录时返回的 notify 会在下一次追加时关闭，
+// off 已经被挤出缓冲区时 ok 为 false。
+func (l *replLog[K, V]) since(off uint64) (recs []walRecord[K, V], notify <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size := uint64(len(l.buf))
+	if off > l.next || l.next-off > size {
+		return nil, nil, false
+	}
+	end := min(l.next, off+replBatch)
+	for o := off + 1; o <= end; o++ {
+		recs = append(recs, l.buf[(o-1)%size])
+	}
+	if len(recs) > 0 {
+		return recs, nil, true
+	}
+	if l.notify == nil {
+		l.notify = make(chan struct{})
+	}
+	return nil, l.notify, true
+}
+
+// ReplicaInfo 是主节点看到的一个副本的状态。
+type ReplicaInfo struct {
+	Addr   string // 副本的远端地址
+	Offset uint64 // 副本确认已应用的偏移
+	Lag    uint64 // 主节点偏移与 Offset 之差，即副本还没应用的写入条数
+}
+
+// ReplicationOffset 返回主节点当前的复制偏移，没有运行中的 ServeReplication 时返回 0。
+func (m *ConcurrentMap[K, V]) ReplicationOffset() uint64 {
+	l := m.repl.Load()
+	if l == nil {
+		return 0
+	}
+	return l.offset()
+}
+
+// Replicas 返回当前连接的副本及其延迟，按地址排序。
+func (m *ConcurrentMap[K, V]) Replicas() []ReplicaInfo {
+	l := m.repl.Load()
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	infos := make([]ReplicaInfo, 0, len(l.replicas))
+	for rc := range l.replicas {
+		acked := rc.acked.Load()
+		infos = append(infos, ReplicaInfo{Addr: rc.addr, Offset: acked, Lag: l.next - min(acked, l.next)})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Addr < infos[j].Addr })
+	return infos
+}
+
+// ServeReplication 让 m 作为主节点，在 ln 上接受副本连接并把之后的每次写入异步推送给它们。
+// 可以同时在多个监听上调用，它们共用一个积压缓冲区：第一个调用开始记录，之前的数据由全量同步传给副本；
+// 最后一个返回时停止记录并释放缓冲区。
+// ctx 结束后关闭监听和所有副本连接，返回 nil。键和值用 encoding/json 编码。
+func (m *ConcurrentMap[K, V]) ServeReplication(ctx context.Context, ln net.Listener) error {
+	l := m.acquireReplLog()
+	defer m.releaseReplLog()
+
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+		wg    sync.WaitGroup
+	)
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for c := range conns {
+			c.Close()
+		}
+	})
+	defer stop()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		mu.Lock()
+		if ctx.Err() != nil {
+			mu.Unlock()
+			c.Close()
+			continue
+		}
+		conns[c] = struct{}{}
+		wg.Add(1)
+		mu.Unlock()
+
+		go func() {
+			defer wg.Done()
+			m.serveReplica(ctx, l, c)
+			c.Close()
+			mu.Lock()
+			delete(conns, c)
+			mu.Unlock()
+		}()
+	}
+}
+
+// acquireReplLog 在第一个 ServeReplication 开始时安装积压缓冲区。安装时锁住所有分片，
+// 保证之后的每次写入都会进入缓冲区。
+func (m *ConcurrentMap[K, V]) acquireReplLog() *replLog[K, V] {
+	m.replMu.Lock()
+	defer m.replMu.Unlock()
+	m.replServers++
+	if l := m.repl.Load(); l != nil {
+		return l
+	}
+	l := newReplLog[K, V](m.replBacklog)
+	// 只需要挡住进行中的写入，不用 snapshot，否则每个分片都会进入写时复制
+	m.lockAll()
+	m.repl.Store(l)
+	m.unlockAll()
+	return l
+}
+
+// releaseReplLog 在最后一个 ServeReplication 返回时卸载积压缓冲区。
+func (m *ConcurrentMap[K, V]) releaseReplLog() {
+	m.replMu.Lock()
+	defer m.replMu.Unlock()
+	if m.replServers--; m.replServers == 0 {
+		m.repl.Store(nil)
+	}
+}
+
+func (m *ConcurrentMap[K, V]) serveReplica(ctx context.Context, l *replLog[K, V], c net.Conn) error {
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+
+	var hello replRecord[K, V]
+	c.SetReadDeadline(time.Now().Add(3 * replPingInterval))
+	if _, err := readFrame(br, &hello); err != nil {
+		return err
+	}
+	c.SetReadDeadline(time.Time{})
+
+	rc := &replicaConn{addr: c.RemoteAddr().String()}
+	rc.acked.Store(hello.Seq)
+	l.mu.Lock()
+	l.replicas[rc] = struct{}{}
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.replicas, rc)
+		l.mu.Unlock()
+	}()
+
+	go func() {
+		for {
+			var ack replRecord[K, V]
+			if _, err := readFrame(br, &ack); err != nil {
+				c.Close()
+				return
+			}
+			rc.acked.Store(ack.Seq)
+		}
+	}()
+
+	// 每次写入都刷新写超时，副本失联时不会永远阻塞在全量同步或推送上
+	send := func(rec replRecord[K, V]) error {
+		frame, err := encodeFrame(rec)
+		if err != nil {
+			return err
+		}
+		c.SetWriteDeadline(time.Now().Add(3 * replPingInterval))
+		_, err = bw.Write(frame)
+		return err
+	}
+	flush := func() error {
+		c.SetWriteDeadline(time.Now().Add(3 * replPingInterval))
+		return bw.Flush()
+	}
+
+	cursor := hello.Seq
+	if _, _, ok := l.since(cursor); hello.ID != l.id || !ok {
+		var err error
+		if cursor, err = m.sendFullSync(l, send); err != nil {
+			return err
+		}
+	} else if err := send(replRecord[K, V]{walRecord: walRecord[K, V]{Op: opContinue}, Seq: cursor}); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(replPingInterval)
+	defer ping.Stop()
+	for {
+		recs, notify, ok := l.since(cursor)
+		if !ok {
+			return errReplicaBehind
+		}
+		for _, rec := range recs {
+			cursor++
+			if err := send(replRecord[K, V]{walRecord: rec, Seq: cursor}); err != nil {
+				return err
+			}
+		}
+		if len(recs) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-notify:
+		case <-ping.C:
+			if err := send(replRecord[K, V]{walRecord: walRecord[K, V]{Op: opPing}, Seq: cursor}); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// sendFullSync 发送一份与偏移严格对应的快照，返回快照所在的偏移。
+func (m *ConcurrentMap[K, V]) sendFullSync(l *replLog[K, V], send func(replRecord[K, V]) error) (uint64, error) {
+	var off uint64
+	snap := m.snapshot(func() {
+		off = l.offset()
+	})
+
+	if err := send(replRecord[K, V]{walRecord: walRecord[K, V]{Op: opSnapshotBegin}, Seq: off, ID: l.id}); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, data := range snap.shards {
+		for k, e := range data {
+			if e.expired(snap.now) {
+				continue
+			}
+			if err := send(replRecord[K, V]{walRecord: walRecord[K, V]{Op: opPut, Key: k, Value: e.value, ExpireAt: e.expireAt}}); err != nil {
+				return 0, err
+			}
+			n++
+		}
+	}
+	return off, send(replRecord[K, V]{walRecord: walRecord[K, V]{Op: opSnapshotEnd, Count: n}, Seq: off})
+}
+
+// Replica 是主节点的只读副本。它在后台保持与主节点的连接，断线后自动重连，
+// 能从断点续传时只补齐缺失的写入，否则重新全量同步。
+// 复制是异步的：主节点的写入返回时副本不一定已经看到，用 Stats 观察延迟。
+type Replica[K comparable, V any] struct {
+	m      *ConcurrentMap[K, V]
+	addr   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	id            string // 只在后台 goroutine 中访问
+	offset        atomic.Uint64
+	primaryOffset atomic.Uint64
+	lastContact   atomic.Int64
+	connected     atomic.Bool
+	fullSyncs     atomic.Uint64
+}
+
+// ReplicaStats 是副本一侧看到的复制状态。
+type ReplicaStats struct {
+	Connected     bool
+	Offset        uint64    // 已应用的偏移
+	PrimaryOffset uint64    // 最近一次从主节点得知的偏移
+	Lag           uint64    // PrimaryOffset 与 Offset 之差
+	LastContact   time.Time // 最近一次收到主节点数据的时间
+	FullSyncs     uint64    // 全量同步的次数
+}
+
+// Follow 创建一个复制 addr 上主节点的副本，opts 用于配置副本本地的 map。
+// ctx 结束后副本停止复制，已有的数据仍然可读。
+func Follow[K comparable, V any](ctx context.Context, addr string, opts ...Option) *Replica[K, V] {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Replica[K, V]{
+		m:      New[K, V](opts...),
+		addr:   addr,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Get 读取副本中的值。
+func (r *Replica[K, V]) Get(k K) (V, bool) {
+	return r.m.Get(k)
+}
+
+// Len 返回副本中的条目数。
+func (r *Replica[K, V]) Len() int {
+	return r.m.Len()
+}
+
+// Range 遍历副本，语义与 ConcurrentMap.Range 相同。
+func (r *Replica[K, V]) Range(fn func(k K, v V) bool) {
+	r.m.Range(fn)
+}
+
+// WaitFor 等待键被复制到副本上。
+func (r *Replica[K, V]) WaitFor(ctx context.Context, k K) (V, error) {
+	return r.m.WaitFor(ctx, k)
+}
+
+// Stats 返回副本的复制状态。
+func (r *Replica[K, V]) Stats() ReplicaStats {
+	st := ReplicaStats{
+		Connected:     r.connected.Load(),
+		Offset:        r.offset.Load(),
+		PrimaryOffset: r.primaryOffset.Load(),
+		FullSyncs:     r.fullSyncs.Load(),
+	}
+	if st.PrimaryOffset > st.Offset {
+		st.Lag = st.PrimaryOffset - st.Offset
+	}
+	if ns := r.lastContact.Load(); ns != 0 {
+		st.LastContact = time.Unix(0, ns)
+	}
+	return st
+}
+
+// Promote 停止复制并把副本的数据作为可写的 map 返回，之后可以在它上面调用 ServeReplication
+// 让其他副本改为跟随它。提升后的 map 使用新的复制 ID，跟随它的副本会先做一次全量同步。
+// 重复调用返回同一个 map。
+func (r *Replica[K, V]) Promote() *ConcurrentMap[K, V] {
+	r.cancel()
+	<-r.done
+	return r.m
+}
+
+func (r *Replica[K, V]) run(ctx context.Context) {
+	defer close(r.done)
+	const maxBackoff = time.Second
+	backoff := 50 * time.Millisecond
+	for {
+		synced := r.follow(ctx)
+		r.connected.Store(false)
+		if synced {
+			backoff = 50 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// follow 连接主节点并应用收到的记录，直到连接断开。收到过主节点的数据时返回 true。
+func (r *Replica[K, V]) follow(ctx context.Context) bool {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return false
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	bw := bufio.NewWriter(c)
+	send := func(rec replRecord[K, V]) error {
+		frame, err := encodeFrame(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(frame); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+	if send(replRecord[K, V]{Seq: r.offset.Load(), ID: r.id}) != nil {
+		return false
+	}
+
+	br := bufio.NewReader(c)
+	synced := false
+	// 全量同步期间记录快照中出现过的键，结束时删掉本地多余的键
+	var loading map[K]struct{}
+	var loadingID string
+	for {
+		c.SetReadDeadline(time.Now().Add(3 * replPingInterval))
+		var rec replRecord[K, V]
+		if _, err := readFrame(br, &rec); err != nil {
+			return synced
+		}
+		synced = true
+		r.connected.Store(true)
+		r.lastContact.Store(time.Now().UnixNano())
+
+		switch rec.Op {
+		case opSnapshotBegin:
+			loading, loadingID = make(map[K]struct{}), rec.ID
+			r.primaryOffset.Store(rec.Seq)
+		case opSnapshotEnd:
+			r.finishFullSync(loading)
+			loading = nil
+			r.id = loadingID
+			r.offset.Store(rec.Seq)
+			r.fullSyncs.Add(1)
+		case opContinue:
+		case opPing:
+			r.primaryOffset.Store(rec.Seq)
+		case opPut, opDelete, opBatch:
+			r.m.apply(rec.walRecord, r.m.nowNano())
+			if loading != nil {
+				loading[rec.Key] = struct{}{}
+				break
+			}
+			r.offset.Store(rec.Seq)
+			if rec.Seq > r.primaryOffset.Load() {
+				r.primaryOffset.Store(rec.Seq)
+			}
+		}
+
+		if loading == nil && br.Buffered() == 0 {
+			if send(replRecord[K, V]{walRecord: walRecord[K, V]{Op: opAck}, Seq: r.offset.Load()}) != nil {
+				return synced
+			}
+		}
+	}
+}
+
+func (r *Replica[K, V]) finishFullSync(seen map[K]struct{}) {
+	var stale []K
+	r.m.Range(func(k K, _ V) bool {
+		if _, ok := seen[k]; !ok {
+			stale = append(stale, k)
+		}
+		return true
+	})
+	for _, k := range stale {
+		r.m.Delete(k)
+	}
+}
@@ -0,0 +1,347 @@
+package cmap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveRepl 在 addr 上启动复制服务，返回实际地址和一个停止服务并等待其返回的函数。
+func serveRepl[K comparable, V any](t *testing.T, m *ConcurrentMap[K, V], addr string) (string, func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.ServeReplication(ctx, ln)
+	}()
+	stopped := false
+	stop := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeReplication: %v", err)
+		}
+	}
+	t.Cleanup(stop)
+	return ln.Addr().String(), stop
+}
+
+// follow 创建一个副本，测试结束时停止它并等待后台 goroutine 退出，不会残留到之后的测试中。
+func follow[K comparable, V any](t *testing.T, addr string) *Replica[K, V] {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := Follow[K, V](ctx, addr)
+	t.Cleanup(func() {
+		cancel()
+		<-r.done
+	})
+	return r
+}
+
+// waitCaughtUp 等待副本完成全量同步并追上主节点当前的偏移。
+func waitCaughtUp[K comparable, V any](t *testing.T, primary *ConcurrentMap[K, V], r *Replica[K, V]) {
+	t.Helper()
+	want := primary.ReplicationOffset()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := r.Stats()
+		if st.Connected && st.FullSyncs > 0 && st.Offset >= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("副本没有追上主节点: %+v, primary offset %d", st, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectSameContent(t *testing.T, primary *ConcurrentMap[string, int], r *Replica[string, int]) {
+	t.Helper()
+	if r.Len() != primary.Len() {
+		t.Fatalf("副本有 %d 个键, 主节点有 %d 个", r.Len(), primary.Len())
+	}
+	primary.Range(func(k string, v int) bool {
+		if got, ok := r.Get(k); !ok || got != v {
+			t.Fatalf("副本 %s = %v, %v, want %v", k, got, ok, v)
+		}
+		return true
+	})
+}
+
+func TestReplicationFullSyncAndStream(t *testing.T) {
+	primary := New[string, int]()
+	for i := 0; i < 100; i++ {
+		primary.Put(fmt.Sprint("old", i), i)
+	}
+	addr, _ := serveRepl(t, primary, "127.0.0.1:0")
+
+	r := follow[string, int](t, addr)
+	waitCaughtUp(t, primary, r)
+	expectSameContent(t, primary, r)
+
+	for i := 0; i < 100; i++ {
+		primary.Put(fmt.Sprint("new", i), i)
+	}
+	primary.Delete("old0")
+	primary.Compute("old1", func(old int, ok bool) (int, bool) { return old + 100, true })
+	before := primary.ReplicationOffset()
+	tx := primary.Txn()
+	tx.Put("old2", -2)
+	tx.Put("old3", -3)
+	tx.Delete("old4")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if n := primary.ReplicationOffset() - before; n != 1 {
+		t.Fatalf("事务占用了 %d 个复制偏移, want 1", n)
+	}
+	waitCaughtUp(t, primary, r)
+	expectSameContent(t, primary, r)
+
+	if st := r.Stats(); st.FullSyncs != 1 || st.Lag != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestReplicationTTL(t *testing.T) {
+	primary := New[string, int]()
+	addr, _ := serveRepl(t, primary, "127.0.0.1:0")
+	r := follow[string, int](t, addr)
+
+	primary.PutWithTTL("short", 1, 50*time.Millisecond)
+	primary.Put("long", 2)
+	waitCaughtUp(t, primary, r)
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := r.Get("short"); ok {
+		t.Fatal("副本上的过期时间应该与主节点一致")
+	}
+	if _, ok := r.Get("long"); !ok {
+		t.Fatal("long 应该还在")
+	}
+}
+
+// 断线期间的写入还在积压缓冲区内时，重连只补齐缺失的部分。
+// 另一个监听上的 ServeReplication 一直运行，积压缓冲区不会被卸载
+func TestReplicationPartialResync(t *testing.T) {
+	primary := New[string, int]()
+	serveRepl(t, primary, "127.0.0.1:0")
+	addr, stop := serveRepl(t, primary, "127.0.0.1:0")
+	r := follow[string, int](t, addr)
+
+	primary.Put("a", 1)
+	waitCaughtUp(t, primary, r)
+	stop()
+
+	primary.Put("b", 2)
+	primary.Delete("a")
+	serveRepl(t, primary, addr)
+
+	waitCaughtUp(t, primary, r)
+	expectSameContent(t, primary, r)
+	if n := r.Stats().FullSyncs; n != 1 {
+		t.Fatalf("FullSyncs = %d, 断点续传不应该再全量同步", n)
+	}
+}
+
+// 断线期间的写入超出积压缓冲区时重新全量同步，副本上多余的键被清理
+func TestReplicationBacklogOverflow(t *testing.T) {
+	primary := New[string, int](WithReplBacklog(4))
+	serveRepl(t, primary, "127.0.0.1:0")
+	addr, stop := serveRepl(t, primary, "127.0.0.1:0")
+	r := follow[string, int](t, addr)
+
+	primary.Put("gone", 1)
+	waitCaughtUp(t, primary, r)
+	stop()
+
+	primary.Delete("gone")
+	for i := 0; i < 10; i++ {
+		primary.Put(fmt.Sprint(i), i)
+	}
+	serveRepl(t, primary, addr)
+
+	waitCaughtUp(t, primary, r)
+	expectSameContent(t, primary, r)
+	if n := r.Stats().FullSyncs; n != 2 {
+		t.Fatalf("FullSyncs = %d, want 2", n)
+	}
+}
+
+// 超过单帧上限的写入在主节点上被拒绝，不会进入复制流让副本反复断线重连
+func TestReplicationRejectsOversizedRecord(t *testing.T) {
+	n := maxFrameSize
+	t.Cleanup(func() { maxFrameSize = n })
+	maxFrameSize = 4 << 10
+
+	primary := New[string, string]()
+	addr, _ := serveRepl(t, primary, "127.0.0.1:0")
+	r := follow[string, string](t, addr)
+
+	primary.Put("a", "1")
+	waitCaughtUp(t, primary, r)
+	primary.Put("big", strings.Repeat("x", maxFrameSize))
+	primary.Put("b", "2")
+	if _, ok := primary.Get("big"); ok {
+		t.Fatal("超过上限的写入不应该生效")
+	}
+	waitCaughtUp(t, primary, r)
+	for k, want := range map[string]string{"a": "1", "b": "2"} {
+		if v, ok := r.Get(k); !ok || v != want {
+			t.Fatalf("副本 Get(%q) = %q, %v, want %q", k, v, ok, want)
+		}
+	}
+	if st := r.Stats(); st.FullSyncs != 1 || !st.Connected {
+		t.Fatalf("stats = %+v, 副本不应该断线重连", st)
+	}
+}
+
+// 开始提供复制只安装积压缓冲区，不让分片进入写时复制
+func TestServeReplicationDoesNotShare(t *testing.T) {
+	primary := New[int, int]()
+	for i := 0; i < 1000; i++ {
+		primary.Put(i, i)
+	}
+	serveRepl(t, primary, "127.0.0.1:0")
+	deadline := time.Now().Add(5 * time.Second)
+	for primary.repl.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("积压缓冲区没有安装")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i, s := range primary.shards {
+		s.mu.RLock()
+		shared := s.shared
+		s.mu.RUnlock()
+		if shared {
+			t.Fatalf("ServeReplication 之后分片 %d 被标记为共享", i)
+		}
+	}
+}
+
+// 最后一个 ServeReplication 返回后积压缓冲区被卸载，再次提供复制时副本重新全量同步
+func TestReplicationUninstallBacklog(t *testing.T) {
+	primary := New[string, int]()
+	addr, stop := serveRepl(t, primary, "127.0.0.1:0")
+	r := follow[string, int](t, addr)
+
+	primary.Put("a", 1)
+	waitCaughtUp(t, primary, r)
+	stop()
+	if l := primary.repl.Load(); l != nil {
+		t.Fatal("所有 ServeReplication 返回后积压缓冲区应该被卸载")
+	}
+	if off := primary.ReplicationOffset(); off != 0 {
+		t.Fatalf("ReplicationOffset() = %d, want 0", off)
+	}
+
+	primary.Put("b", 2)
+	serveRepl(t, primary, addr)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Stats().FullSyncs < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("副本没有重新全量同步: %+v", r.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	expectSameContent(t, primary, r)
+}
+
+// 推送者只在等待时才需要通知，没有副本等待时写入不分配 channel
+func TestReplLogNotify(t *testing.T) {
+	l := newReplLog[string, int](8)
+	l.append(walRecord[string, int]{Op: opPut, Key: "a"})
+	if l.notify != nil {
+		t.Fatal("没有等待者时不应该创建 notify")
+	}
+
+	recs, notify, ok := l.since(0)
+	if !ok || len(recs) != 1 || notify != nil {
+		t.Fatalf("since(0) = %v, %v, %v", recs, notify, ok)
+	}
+	_, notify, ok = l.since(1)
+	if !ok || notify == nil {
+		t.Fatalf("since(1) = %v, %v, 追上之后应该返回 notify", notify, ok)
+	}
+	l.append(walRecord[string, int]{Op: opPut, Key: "b"})
+	select {
+	case <-notify:
+	default:
+		t.Fatal("追加之后 notify 应该被关闭")
+	}
+	if l.notify != nil {
+		t.Fatal("关闭之后 notify 应该被清空，等下一个等待者再创建")
+	}
+}
+
+func TestReplicaLagMetrics(t *testing.T) {
+	primary := New[string, int]()
+	addr, _ := serveRepl(t, primary, "127.0.0.1:0")
+	r1 := follow[string, int](t, addr)
+	r2 := follow[string, int](t, addr)
+
+	for i := 0; i < 50; i++ {
+		primary.Put(fmt.Sprint(i), i)
+	}
+	waitCaughtUp(t, primary, r1)
+	waitCaughtUp(t, primary, r2)
+
+	// ack 是异步的，等主节点看到两个副本都确认
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		infos := primary.Replicas()
+		if len(infos) == 2 && infos[0].Lag == 0 && infos[1].Lag == 0 {
+			if infos[0].Offset != primary.ReplicationOffset() {
+				t.Fatalf("replica offset = %d, want %d", infos[0].Offset, primary.ReplicationOffset())
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Replicas() = %+v", infos)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st := r1.Stats()
+	if st.LastContact.IsZero() || st.PrimaryOffset != primary.ReplicationOffset() {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestReplicaPromote(t *testing.T) {
+	primary := New[string, int]()
+	addr, stopPrimary := serveRepl(t, primary, "127.0.0.1:0")
+	r := follow[string, int](t, addr)
+
+	primary.Put("a", 1)
+	waitCaughtUp(t, primary, r)
+	stopPrimary()
+
+	promoted := r.Promote()
+	if r.Promote() != promoted {
+		t.Fatal("重复 Promote 应该返回同一个 map")
+	}
+	if v, ok := promoted.Get("a"); !ok || v != 1 {
+		t.Fatal("提升后应该保留已复制的数据")
+	}
+	promoted.Put("b", 2)
+
+	// 提升后的节点可以继续作为主节点
+	newAddr, _ := serveRepl(t, promoted, "127.0.0.1:0")
+	r2 := follow[string, int](t, newAddr)
+	waitCaughtUp(t, promoted, r2)
+	expectSameContent(t, promoted, r2)
+
+	if r.Stats().Connected {
+		t.Fatal("提升后不应该再连接旧的主节点")
+	}
+}
@@ -0,0 +1,190 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error 是服务端返回的错误回复。
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Client 是一个最小的 RESP2 客户端，只覆盖 Server 支持的命令。
+// 方法可以并发调用，同一时刻只有一条命令在连接上往返。
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// Dial 连接 addr 上的服务。
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}, nil
+}
+
+// Close 关闭连接。
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Get 读取键，键不存在时 ok 为 false。
+func (c *Client) Get(k string) (v string, ok bool, err error) {
+	reply, err := c.do("GET", k)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("resp: GET 回复类型 %T", reply)
+	}
+	return s, true, nil
+}
+
+// Put 写入键。
+func (c *Client) Put(k, v string) error {
+	_, err := c.do("SET", k, v)
+	return err
+}
+
+// PutWithTTL 写入一个在 ttl 之后过期的键，ttl <= 0 表示永不过期。服务端按毫秒计时，不足一毫秒的按一毫秒算。
+func (c *Client) PutWithTTL(k, v string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return c.Put(k, v)
+	}
+	ms := (ttl + time.Millisecond - 1) / time.Millisecond
+	_, err := c.do("SET", k, v, "PX", strconv.FormatInt(int64(ms), 10))
+	return err
+}
+
+// TTL 返回键的剩余存活时间，0 表示永不过期；键不存在时 ok 为 false。
+func (c *Client) TTL(k string) (ttl time.Duration, ok bool, err error) {
+	reply, err := c.do("PTTL", k)
+	if err != nil {
+		return 0, false, err
+	}
+	ms, isInt := reply.(int64)
+	switch {
+	case !isInt:
+		return 0, false, fmt.Errorf("resp: PTTL 回复类型 %T", reply)
+	case ms == -2:
+		return 0, false, nil
+	case ms < 0:
+		return 0, true, nil
+	}
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
+// Delete 删除键，返回键是否存在。
+func (c *Client) Delete(k string) (bool, error) {
+	reply, err := c.do("DEL", k)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// Range 先用 KEYS * 列出所有键再逐个读取，遍历期间被删除的键会被跳过。
+func (c *Client) Range(fn func(k, v string) bool) error {
+	reply, err := c.do("KEYS", "*")
+	if err != nil {
+		return err
+	}
+	keys, _ := reply.([]any)
+	for _, k := range keys {
+		k, _ := k.(string)
+		v, ok, err := c.Get(k)
+		if err != nil {
+			return err
+		}
+		if ok && !fn(k, v) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// do 发送一条命令并读取回复：简单字符串和 bulk string 是 string，整数是 int64，
+// 空值是 nil，数组是 []any，错误回复转成 Error。
+func (c *Client) do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := readReply(c.r)
+	if e, ok := reply.(Error); ok && err == nil {
+		return nil, e
+	}
+	return reply, err
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: 空回复", errProtocol)
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: 非法的 bulk 长度 %q", errProtocol, line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: 非法的数组长度 %q", errProtocol, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			if e, ok := item.(Error); ok {
+				return nil, e
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%w: 未知的回复类型 %q", errProtocol, line)
+}
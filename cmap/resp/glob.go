@@ -0,0 +1,85 @@
+package resp
+
+// globMatch 实现 Redis KEYS 的通配规则：* 匹配任意串，? 匹配单个字符，
+// [abc]、[a-z]、[^a] 匹配字符集合，\ 转义下一个字符。与 path.Match 不同，* 可以匹配 /。
+func globMatch(pattern, s string) bool {
+	p, n := []rune(pattern), []rune(s)
+	// 回溯点：最近一个 * 的位置以及它当前吞到 s 的哪里
+	star, mark := -1, 0
+	i, j := 0, 0
+	for j < len(n) {
+		if i < len(p) {
+			switch p[i] {
+			case '*':
+				star, mark = i, j
+				i++
+				continue
+			case '?':
+				i++
+				j++
+				continue
+			case '[':
+				if next, ok := matchClass(p, i, n[j]); ok {
+					i = next
+					j++
+					continue
+				}
+			case '\\':
+				if i+1 < len(p) && p[i+1] == n[j] {
+					i += 2
+					j++
+					continue
+				}
+			default:
+				if p[i] == n[j] {
+					i++
+					j++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		i = star + 1
+		mark++
+		j = mark
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// matchClass 匹配从 p[i] == '[' 开始的字符集合，返回集合之后的位置以及 c 是否属于该集合。
+func matchClass(p []rune, i int, c rune) (int, bool) {
+	i++
+	negate := i < len(p) && p[i] == '^'
+	if negate {
+		i++
+	}
+	matched := false
+	for i < len(p) && p[i] != ']' {
+		switch {
+		case p[i] == '\\' && i+1 < len(p):
+			i++
+			matched = matched || p[i] == c
+			i++
+		case i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']':
+			lo, hi := p[i], p[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			i += 3
+		default:
+			matched = matched || p[i] == c
+			i++
+		}
+	}
+	if i >= len(p) {
+		// 没有闭合的 ]，Redis 把它当作匹配到结尾
+		return i, matched != negate
+	}
+	return i + 1, matched != negate
+}
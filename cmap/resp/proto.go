@@ -0,0 +1,112 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLen    = 512 << 20 // 与 Redis 的 proto-max-bulk-len 默认值一致
+	maxInlineSize = 64 << 10  // 与 Redis 的 PROTO_INLINE_MAX_SIZE 一致
+)
+
+// errProtocol 表示客户端发来的数据不符合 RESP 格式，连接无法继续使用。
+var errProtocol = errors.New("resp: 协议错误")
+
+// readCommand 读取一条命令，支持 RESP 数组（*N\r\n$len\r\n...）和 telnet 风格的内联命令。
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, fmt.Errorf("%w: 非法的数组长度 %q", errProtocol, line)
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: 期望 bulk string, 得到 %q", errProtocol, line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: 非法的 bulk 长度 %q", errProtocol, line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string 缺少结尾的 CRLF", errProtocol)
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine 读取一行并去掉结尾的 CRLF。单行超过 maxInlineSize 视为协议错误，
+// 避免客户端一直不发换行时把整个输入攒在内存里。
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		if len(line)+len(frag) > maxInlineSize {
+			return "", fmt.Errorf("%w: 单行超过 %d 字节", errProtocol, maxInlineSize)
+		}
+		line = append(line, frag...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// writer 封装 RESP2 的几种回复类型。
+type writer struct {
+	*bufio.Writer
+}
+
+func (w writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func (w writer) error(s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func (w writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+func (w writer) array(items []string) {
+	w.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, s := range items {
+		w.bulk(s)
+	}
+}
@@ -0,0 +1,314 @@
+// Package resp 在 cmap.ConcurrentMap 之上提供一个说 RESP2 协议的 TCP 服务，
+// 支持 GET、SET（含 EX 和 PX）、PTTL、DEL、EXISTS、INCR、KEYS、PING、INFO 和 QUIT，可以直接用 redis-cli 访问。
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"review/cmap"
+)
+
+// Server 为每个连接启动一个 goroutine，按顺序执行连接上的命令。
+// 客户端可以流水线（pipelining）发送多条命令，服务端在读缓冲区耗尽时才统一刷出回复。
+type Server struct {
+	m       *cmap.ConcurrentMap[string, string]
+	started time.Time
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+
+	connsTotal atomic.Uint64
+	commands   atomic.Uint64
+}
+
+// NewServer 创建一个以 m 为存储的服务。
+func NewServer(m *cmap.ConcurrentMap[string, string]) *Server {
+	return &Server{
+		m:     m,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve 在 ln 上接受连接，直到 ctx 结束或 Accept 出错。
+// ctx 结束后停止接受新连接，每个连接执行完已经收到的命令并刷出回复后关闭，Serve 等所有连接退出后返回 nil。
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	s.started = time.Now()
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for c := range s.conns {
+			// 让阻塞的读立即返回，已经读进缓冲区的命令仍会被执行
+			c.SetReadDeadline(time.Now())
+		}
+	})
+	defer stop()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			s.wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if ctx.Err() != nil {
+			s.mu.Unlock()
+			c.Close()
+			continue
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		s.connsTotal.Add(1)
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(c)
+	w := writer{bufio.NewWriter(c)}
+	defer w.Flush()
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.error("ERR Protocol error: " + err.Error())
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.commands.Add(1)
+		if !s.exec(w, args) {
+			return
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// exec 执行一条命令并写入回复，返回 false 表示要关闭连接。
+func (s *Server) exec(w writer, args []string) bool {
+	name := strings.ToLower(args[0])
+	args = args[1:]
+
+	arity := func(min, max int) bool {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+			return false
+		}
+		return true
+	}
+
+	switch name {
+	case "ping":
+		if !arity(0, 1) {
+			break
+		}
+		if len(args) == 1 {
+			w.bulk(args[0])
+		} else {
+			w.simple("PONG")
+		}
+
+	case "get":
+		if !arity(1, 1) {
+			break
+		}
+		if v, ok := s.m.Get(args[0]); ok {
+			w.bulk(v)
+		} else {
+			w.null()
+		}
+
+	case "set":
+		if !arity(2, 4) {
+			break
+		}
+		s.set(w, args)
+
+	case "pttl":
+		if !arity(1, 1) {
+			break
+		}
+		w.integer(s.pttl(args[0]))
+
+	case "del":
+		if !arity(1, -1) {
+			break
+		}
+		var n int64
+		for _, k := range args {
+			if s.m.Delete(k) {
+				n++
+			}
+		}
+		w.integer(n)
+
+	case "exists":
+		if !arity(1, -1) {
+			break
+		}
+		var n int64
+		for _, k := range args {
+			if _, ok := s.m.Get(k); ok {
+				n++
+			}
+		}
+		w.integer(n)
+
+	case "incr":
+		if !arity(1, 1) {
+			break
+		}
+		s.incr(w, args[0])
+
+	case "keys":
+		if !arity(1, 1) {
+			break
+		}
+		var keys []string
+		s.m.Range(func(k, v string) bool {
+			if globMatch(args[0], k) {
+				keys = append(keys, k)
+			}
+			return true
+		})
+		sort.Strings(keys)
+		w.array(keys)
+
+	case "info":
+		if !arity(0, 1) {
+			break
+		}
+		w.bulk(s.info())
+
+	case "quit":
+		w.simple("OK")
+		return false
+
+	default:
+		w.error(fmt.Sprintf("ERR unknown command '%s'", name))
+	}
+	return true
+}
+
+func (s *Server) set(w writer, args []string) {
+	k, v := args[0], args[1]
+	if len(args) == 2 {
+		s.m.Put(k, v)
+		w.simple("OK")
+		return
+	}
+	unit := time.Second
+	if len(args) == 4 && strings.EqualFold(args[2], "px") {
+		unit = time.Millisecond
+	} else if len(args) != 4 || !strings.EqualFold(args[2], "ex") {
+		w.error("ERR syntax error")
+		return
+	}
+	n, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		w.error("ERR value is not an integer or out of range")
+		return
+	}
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		w.error("ERR invalid expire time in 'set' command")
+		return
+	}
+	s.m.PutWithTTL(k, v, time.Duration(n)*unit)
+	w.simple("OK")
+}
+
+// pttl 按 Redis 的约定返回剩余毫秒数：键不存在返回 -2，永不过期返回 -1。
+// 不足一毫秒的向上取整，还没过期的键不会被报告成 0。
+func (s *Server) pttl(k string) int64 {
+	ttl, ok := s.m.TTL(k)
+	switch {
+	case !ok:
+		return -2
+	case ttl == 0:
+		return -1
+	}
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+// incr 先读出旧值并检查它是整数，再用 CompareAndSwap 写回，被并发修改时重试。
+// 旧值不是整数时不做任何写入，不会产生新版本、WAL 记录或 watch 事件。
+func (s *Server) incr(w writer, k string) {
+	for {
+		old, ok := s.m.Get(k)
+		if !ok {
+			if _, loaded := s.m.LoadOrStore(k, "1"); !loaded {
+				w.integer(1)
+				return
+			}
+			continue
+		}
+		n, err := strconv.ParseInt(old, 10, 64)
+		if err != nil || n == math.MaxInt64 {
+			w.error("ERR value is not an integer or out of range")
+			return
+		}
+		if s.m.CompareAndSwap(k, old, strconv.FormatInt(n+1, 10)) {
+			w.integer(n + 1)
+			return
+		}
+	}
+}
+
+func (s *Server) info() string {
+	st := s.m.Stats()
+	s.mu.Lock()
+	clients := len(s.conns)
+	s.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Server\r\n")
+	fmt.Fprintf(&b, "process_id:%d\r\n", os.Getpid())
+	fmt.Fprintf(&b, "uptime_in_seconds:%d\r\n", int64(time.Since(s.started).Seconds()))
+	fmt.Fprintf(&b, "\r\n# Clients\r\n")
+	fmt.Fprintf(&b, "connected_clients:%d\r\n", clients)
+	fmt.Fprintf(&b, "\r\n# Stats\r\n")
+	fmt.Fprintf(&b, "total_connections_received:%d\r\n", s.connsTotal.Load())
+	fmt.Fprintf(&b, "total_commands_processed:%d\r\n", s.commands.Load())
+	fmt.Fprintf(&b, "keyspace_hits:%d\r\n", st.Hits)
+	fmt.Fprintf(&b, "keyspace_misses:%d\r\n", st.Misses)
+	fmt.Fprintf(&b, "expired_keys:%d\r\n", st.Expirations)
+	fmt.Fprintf(&b, "evicted_keys:%d\r\n", st.Evictions)
+	fmt.Fprintf(&b, "\r\n# Keyspace\r\n")
+	fmt.Fprintf(&b, "db0:keys=%d\r\n", s.m.Len())
+	return b.String()
+}
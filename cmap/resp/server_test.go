@@ -0,0 +1,432 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"review/cmap"
+)
+
+// startServer 在回环地址上启动服务，测试结束时通过 ctx 优雅关闭
+func startServer(t *testing.T) (*cmap.ConcurrentMap[string, string], string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := cmap.New[string, string]()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- NewServer(m).Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return m, ln.Addr().String()
+}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func encode(args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return b.String()
+}
+
+func (c *client) send(cmds ...[]string) {
+	c.t.Helper()
+	var b strings.Builder
+	for _, args := range cmds {
+		b.WriteString(encode(args...))
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// reply 读取一条回复并转成便于比较的字符串：简单字符串和错误保留前缀，数组用空格连接
+func (c *client) reply() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.reply()
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	return line
+}
+
+func (c *client) do(args ...string) string {
+	c.t.Helper()
+	c.send(args)
+	return c.reply()
+}
+
+func TestCommands(t *testing.T) {
+	m, addr := startServer(t)
+	c := dial(t, addr)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"ping", "hi"}, "hi"},
+		{[]string{"GET", "a"}, "(nil)"},
+		{[]string{"SET", "a", "1"}, "+OK"},
+		{[]string{"GET", "a"}, "1"},
+		{[]string{"INCR", "a"}, ":2"},
+		{[]string{"INCR", "counter"}, ":1"},
+		{[]string{"SET", "s", "abc"}, "+OK"},
+		{[]string{"INCR", "s"}, "-ERR value is not an integer or out of range"},
+		{[]string{"EXISTS", "a", "s", "missing"}, ":2"},
+		{[]string{"KEYS", "*"}, "[a counter s]"},
+		{[]string{"KEYS", "c?unt*"}, "[counter]"},
+		{[]string{"DEL", "a", "missing"}, ":1"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"SET", "k", "v", "KEEPTTL", "1"}, "-ERR syntax error"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'flushall'"},
+	}
+	for _, tc := range cases {
+		if got := c.do(tc.args...); got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if _, ok := m.Get("counter"); !ok {
+		t.Fatal("命令应该作用在底层的 map 上")
+	}
+}
+
+// INCR 遇到非整数时不能产生任何写入：版本号不变，watch 也收不到事件
+func TestIncrNotIntegerDoesNotWrite(t *testing.T) {
+	m, addr := startServer(t)
+	c := dial(t, addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := m.Watch(ctx, "s")
+	c.do("SET", "s", "abc")
+	<-events
+	rev := m.Revision()
+
+	if got := c.do("INCR", "s"); got != "-ERR value is not an integer or out of range" {
+		t.Fatalf("INCR s = %q", got)
+	}
+	if got := m.Revision(); got != rev {
+		t.Fatalf("失败的 INCR 后 Revision() = %d, want %d", got, rev)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("失败的 INCR 不应该产生 watch 事件, got %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSetEX(t *testing.T) {
+	m, addr := startServer(t)
+	c := dial(t, addr)
+
+	if got := c.do("SET", "session", "x", "EX", "100"); got != "+OK" {
+		t.Fatalf("SET EX = %q", got)
+	}
+	// TTL 生效：覆盖为 1 秒后等待过期
+	c.do("SET", "session", "x", "ex", "1")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := m.Get("session"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("SET EX 的键没有过期")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := c.do("GET", "session"); got != "(nil)" {
+		t.Fatalf("过期后 GET = %q", got)
+	}
+}
+
+func TestSetPXAndPTTL(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	if got := c.do("SET", "session", "x", "PX", "100000"); got != "+OK" {
+		t.Fatalf("SET PX = %q", got)
+	}
+	ms, err := strconv.Atoi(strings.TrimPrefix(c.do("PTTL", "session"), ":"))
+	if err != nil || ms <= 99000 || ms > 100000 {
+		t.Fatalf("PTTL = %d, %v, want 约 100000", ms, err)
+	}
+	c.do("SET", "plain", "y")
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PTTL", "plain"}, ":-1"},
+		{[]string{"PTTL", "missing"}, ":-2"},
+		{[]string{"SET", "k", "v", "PX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "k", "v", "EX", "9223372036854775807"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "k", "v", "XX", "1"}, "-ERR syntax error"},
+	} {
+		if got := c.do(tc.args...); got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestPipelining(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	const n = 1000
+	cmds := make([][]string, 0, n+1)
+	for i := 0; i < n; i++ {
+		cmds = append(cmds, []string{"INCR", "k"})
+	}
+	cmds = append(cmds, []string{"GET", "k"})
+	c.send(cmds...)
+
+	for i := 1; i <= n; i++ {
+		if got := c.reply(); got != ":"+strconv.Itoa(i) {
+			t.Fatalf("第 %d 个回复 = %q", i, got)
+		}
+	}
+	if got := c.reply(); got != strconv.Itoa(n) {
+		t.Fatalf("GET = %q", got)
+	}
+}
+
+func TestInlineCommand(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	io.WriteString(c.conn, "SET k v\r\nGET k\r\n")
+	if got := c.reply(); got != "+OK" {
+		t.Fatalf("SET = %q", got)
+	}
+	if got := c.reply(); got != "v" {
+		t.Fatalf("GET = %q", got)
+	}
+}
+
+// 一直不发换行的内联命令不能无限占用内存，超过 64 KiB 回协议错误并断开
+func TestInlineTooLong(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	// 多发一个缓冲区的量，保证服务端判定超长时已经读完全部输入，关闭连接不会触发 RST
+	io.WriteString(c.conn, strings.Repeat("a", maxInlineSize+4096))
+	if got := c.reply(); !strings.HasPrefix(got, "-ERR Protocol error") {
+		t.Fatalf("超长内联命令的回复 = %q", got)
+	}
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("协议错误后连接应该被关闭, err = %v", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	c.do("SET", "a", "1")
+	c.do("GET", "a")
+	c.do("GET", "missing")
+	info := c.do("INFO")
+	for _, want := range []string{"keyspace_hits:1", "keyspace_misses:1", "db0:keys=1", "connected_clients:1"} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("INFO 缺少 %q:\n%s", want, info)
+		}
+	}
+}
+
+func TestQuit(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	if got := c.do("QUIT"); got != "+OK" {
+		t.Fatalf("QUIT = %q", got)
+	}
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("QUIT 后连接应该被关闭, err = %v", err)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	m, addr := startServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := dial(t, addr)
+			for j := 0; j < 100; j++ {
+				c.do("INCR", "shared")
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("shared"); v != "1000" {
+		t.Fatalf("shared = %q, want 1000", v)
+	}
+}
+
+// ctx 结束后 Serve 返回，已经收到的命令执行完并刷出回复，空闲连接被关闭
+func TestGracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- NewServer(cmap.New[string, string]()).Serve(ctx, ln)
+	}()
+
+	c := dial(t, ln.Addr().String())
+	if got := c.do("SET", "k", "v"); got != "+OK" {
+		t.Fatalf("SET = %q", got)
+	}
+	c.send([]string{"GET", "k"}, []string{"PING"})
+	if got := c.reply(); got != "v" {
+		t.Fatalf("GET = %q", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Serve = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve 没有在 ctx 结束后返回")
+	}
+	if got := c.reply(); got != "+PONG" {
+		t.Fatalf("关闭前已收到的命令应该被执行, got %q", got)
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatal("关闭后不应该再接受连接")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:age", false},
+	}
+	for _, tc := range cases {
+		if got := globMatch(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	_, addr := startServer(t)
+	c, err := Dial(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, ok, err := c.Get("a"); ok || err != nil {
+		t.Fatalf("Get 不存在的键 = %v, %v", ok, err)
+	}
+	c.Put("a", "1")
+	c.Put("b", "2")
+	if v, ok, err := c.Get("a"); v != "1" || !ok || err != nil {
+		t.Fatalf("Get = %q, %v, %v", v, ok, err)
+	}
+
+	got := map[string]string{}
+	if err := c.Range(func(k, v string) bool { got[k] = v; return true }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["b"] != "2" {
+		t.Fatalf("Range = %v", got)
+	}
+
+	if ok, err := c.Delete("a"); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+
+	if err := c.PutWithTTL("s", "3", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, ok, err := c.TTL("s"); !ok || err != nil || ttl <= 59*time.Second || ttl > time.Minute {
+		t.Fatalf("TTL(s) = %v, %v, %v, want 约 1m", ttl, ok, err)
+	}
+	if ttl, ok, err := c.TTL("b"); !ok || err != nil || ttl != 0 {
+		t.Fatalf("TTL(b) = %v, %v, %v, want 0, true", ttl, ok, err)
+	}
+	if _, ok, err := c.TTL("a"); ok || err != nil {
+		t.Fatalf("TTL(a) = %v, %v, 已删除的键应该返回 false", ok, err)
+	}
+	if _, err := c.do("INCR", "b", "extra"); err == nil {
+		t.Fatal("错误回复应该转成 error")
+	}
+}
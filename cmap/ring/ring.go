@@ -0,0 +1,405 @@
+// Package ring 用带虚拟节点和权重的一致性哈希把键分散到多个分区上，
+// 分区可以是本进程内的 cmap.ConcurrentMap，也可以是远程的 resp 服务。
+// 增删分区时只迁移归属发生变化的那部分键。
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"review/cmap"
+)
+
+const defaultVirtualNodes = 160
+
+// ErrEmpty 表示环上还没有任何分区。
+var ErrEmpty = errors.New("ring: 没有可用的分区")
+
+// Partition 是环上的一个分区。远程分区的方法可能失败，所以都带 error。
+// 迁移键时用 TTL 读出剩余存活时间、用 PutWithTTL 写入新分区，带过期时间的键迁移后仍按原来的时刻过期。
+type Partition[V any] interface {
+	Get(k string) (V, bool, error)
+	Put(k string, v V) error
+	// PutWithTTL 写入一个在 ttl 之后过期的键，ttl <= 0 表示永不过期
+	PutWithTTL(k string, v V, ttl time.Duration) error
+	// TTL 返回键的剩余存活时间，0 表示永不过期，键不存在时 ok 为 false
+	TTL(k string) (ttl time.Duration, ok bool, err error)
+	Delete(k string) (bool, error)
+	Range(fn func(k string, v V) bool) error
+}
+
+// Local 把本地的 ConcurrentMap 包装成分区。
+func Local[V any](m *cmap.ConcurrentMap[string, V]) Partition[V] {
+	return local[V]{m}
+}
+
+type local[V any] struct {
+	m *cmap.ConcurrentMap[string, V]
+}
+
+func (l local[V]) Get(k string) (V, bool, error) {
+	v, ok := l.m.Get(k)
+	return v, ok, nil
+}
+
+func (l local[V]) Put(k string, v V) error {
+	l.m.Put(k, v)
+	return nil
+}
+
+func (l local[V]) PutWithTTL(k string, v V, ttl time.Duration) error {
+	l.m.PutWithTTL(k, v, ttl)
+	return nil
+}
+
+func (l local[V]) TTL(k string) (time.Duration, bool, error) {
+	ttl, ok := l.m.TTL(k)
+	return ttl, ok, nil
+}
+
+func (l local[V]) Delete(k string) (bool, error) {
+	return l.m.Delete(k), nil
+}
+
+func (l local[V]) Range(fn func(k string, v V) bool) error {
+	l.m.Range(fn)
+	return nil
+}
+
+// Option 配置 Ring。
+type Option func(*options)
+
+type options struct {
+	virtualNodes int
+}
+
+// WithVirtualNodes 设置每单位权重对应的虚拟节点数，默认 160。
+// 虚拟节点越多分布越均匀，但环越大、查找越慢。
+func WithVirtualNodes(n int) Option {
+	return func(o *options) {
+		o.virtualNodes = n
+	}
+}
+
+type node[V any] struct {
+	name   string
+	weight int
+	part   Partition[V]
+}
+
+type point[V any] struct {
+	hash uint64
+	node *node[V]
+}
+
+// Ring 把键路由到分区。读写持有读锁，增删分区持有写锁并在其间完成迁移，
+// 所以迁移期间的读写会等待迁移结束，任何时刻都只从键的唯一归属分区读写。
+// 哈希与进程无关，使用相同分区名、权重和虚拟节点数的 Ring 对键的划分完全一致。
+type Ring[V any] struct {
+	vnodes int
+
+	mu     sync.RWMutex
+	nodes  map[string]*node[V]
+	points []point[V] // 按 hash 升序
+}
+
+// New 创建一个空的 Ring。
+func New[V any](opts ...Option) *Ring[V] {
+	o := options{virtualNodes: defaultVirtualNodes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Ring[V]{
+		vnodes: max(o.virtualNodes, 1),
+		nodes:  make(map[string]*node[V]),
+	}
+}
+
+// hash 是 FNV-1a 加 splitmix64 的收尾混合，FNV 对只差最后几个字节的字符串分布不够散。
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (r *Ring[V]) build(nodes map[string]*node[V]) []point[V] {
+	var points []point[V]
+	for _, n := range nodes {
+		for i := 0; i < n.weight*r.vnodes; i++ {
+			points = append(points, point[V]{hash(n.name + "#" + strconv.Itoa(i)), n})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return points[i].node.name < points[j].node.name
+	})
+	return points
+}
+
+// owner 返回顺时针方向第一个不小于 h 的虚拟节点所属的分区。
+func owner[V any](points []point[V], h uint64) *node[V] {
+	i := sort.Search(len(points), func(i int) bool { return points[i].hash >= h })
+	if i == len(points) {
+		i = 0
+	}
+	return points[i].node
+}
+
+func (r *Ring[V]) locate(k string) (*node[V], error) {
+	if len(r.points) == 0 {
+		return nil, ErrEmpty
+	}
+	return owner(r.points, hash(k)), nil
+}
+
+// Locate 返回键所属分区的名字。
+func (r *Ring[V]) Locate(k string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, err := r.locate(k)
+	if err != nil {
+		return "", err
+	}
+	return n.name, nil
+}
+
+// Get 从键所属的分区读取。
+func (r *Ring[V]) Get(k string) (v V, ok bool, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, err := r.locate(k)
+	if err != nil {
+		return v, false, err
+	}
+	return n.part.Get(k)
+}
+
+// Put 写入键所属的分区。
+func (r *Ring[V]) Put(k string, v V) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, err := r.locate(k)
+	if err != nil {
+		return err
+	}
+	return n.part.Put(k, v)
+}
+
+// Delete 从键所属的分区删除。
+func (r *Ring[V]) Delete(k string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, err := r.locate(k)
+	if err != nil {
+		return false, err
+	}
+	return n.part.Delete(k)
+}
+
+// Range 依次遍历每个分区，分区的顺序不确定。
+func (r *Ring[V]) Range(fn func(k string, v V) bool) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stopped := false
+	for _, name := range r.names() {
+		err := r.nodes[name].part.Range(func(k string, v V) bool {
+			stopped = !fn(k, v)
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Ring[V]) names() []string {
+	names := make([]string, 0, len(r.nodes))
+	for name := range r.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add 以 weight 倍的虚拟节点把分区加入环，把现在归它所有的键从原来的分区迁过来，返回迁移的键数。
+// 只有被新虚拟节点切走了区间的分区需要扫描。迁移失败时已迁移的键会被搬回，环保持不变。
+func (r *Ring[V]) Add(name string, weight int, p Partition[V]) (moved int, err error) {
+	if weight <= 0 {
+		return 0, fmt.Errorf("ring: 分区 %q 的权重 %d 必须为正", name, weight)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.nodes[name]; ok {
+		return 0, fmt.Errorf("ring: 分区 %q 已存在", name)
+	}
+
+	added := &node[V]{name: name, weight: weight, part: p}
+	nodes := clone(r.nodes)
+	nodes[name] = added
+	points := r.build(nodes)
+
+	// 新虚拟节点所在的区间原来属于哪些分区，只有它们会失去键
+	affected := make(map[*node[V]]bool)
+	if len(r.points) > 0 {
+		for _, pt := range points {
+			if pt.node == added {
+				affected[owner(r.points, pt.hash)] = true
+			}
+		}
+	}
+
+	var sources []*node[V]
+	for n := range affected {
+		sources = append(sources, n)
+	}
+	moved, err = migrate(sources, points)
+	if err != nil {
+		return 0, err
+	}
+	r.nodes, r.points = nodes, points
+	return moved, nil
+}
+
+// Remove 把分区移出环，它上面的键迁到各自新的归属分区，返回迁移的键数。
+// 最后一个分区不能移除，除非它已经是空的。迁移失败时已迁移的键会被搬回，环保持不变。
+func (r *Ring[V]) Remove(name string) (moved int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed, ok := r.nodes[name]
+	if !ok {
+		return 0, fmt.Errorf("ring: 分区 %q 不存在", name)
+	}
+
+	nodes := clone(r.nodes)
+	delete(nodes, name)
+	points := r.build(nodes)
+	if len(points) == 0 {
+		// 没有别的分区可以接收，只允许移除空分区
+		empty := true
+		if err := removed.part.Range(func(string, V) bool { empty = false; return false }); err != nil {
+			return 0, err
+		}
+		if !empty {
+			return 0, fmt.Errorf("ring: 不能移除最后一个非空分区 %q", name)
+		}
+	} else if moved, err = migrate([]*node[V]{removed}, points); err != nil {
+		return 0, err
+	}
+	r.nodes, r.points = nodes, points
+	return moved, nil
+}
+
+type move[V any] struct {
+	k        string
+	v        V
+	ttl      time.Duration
+	from, to *node[V]
+}
+
+// migrate 把 sources 中按 points 不再归自己所有的键搬到新的归属分区，剩余存活时间随键一起搬走。
+// 先写目标再删源，中途失败时把已经搬走的键写回源分区并从目标删除。
+func migrate[V any](sources []*node[V], points []point[V]) (int, error) {
+	var moves []move[V]
+	for _, src := range sources {
+		var err error
+		rangeErr := src.part.Range(func(k string, v V) bool {
+			to := owner(points, hash(k))
+			if to == src {
+				return true
+			}
+			ttl, ok, e := src.part.TTL(k)
+			if e != nil {
+				err = e
+				return false
+			}
+			if ok {
+				// 扫描到之后才过期的键不必迁移
+				moves = append(moves, move[V]{k, v, ttl, src, to})
+			}
+			return true
+		})
+		if err == nil {
+			err = rangeErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("ring: 扫描分区 %q: %w", src.name, err)
+		}
+	}
+
+	for i, mv := range moves {
+		err := mv.to.part.PutWithTTL(mv.k, mv.v, mv.ttl)
+		if err == nil {
+			_, err = mv.from.part.Delete(mv.k)
+		}
+		if err != nil {
+			for _, done := range moves[:i+1] {
+				done.from.part.PutWithTTL(done.k, done.v, done.ttl)
+				done.to.part.Delete(done.k)
+			}
+			return 0, fmt.Errorf("ring: 迁移 %q 从 %q 到 %q: %w", mv.k, mv.from.name, mv.to.name, err)
+		}
+	}
+	return len(moves), nil
+}
+
+func clone[V any](nodes map[string]*node[V]) map[string]*node[V] {
+	c := make(map[string]*node[V], len(nodes)+1)
+	for k, v := range nodes {
+		c[k] = v
+	}
+	return c
+}
+
+// Balance 描述哈希空间在各分区之间的划分。
+type Balance struct {
+	// Shares 是每个分区实际拥有的哈希空间比例，总和为 1
+	Shares map[string]float64
+	// Skew 是所有分区中 实际比例/按权重应得的比例 的最大值，1 表示完全均匀，
+	// 1.2 表示负载最重的分区比应得的多拿了 20%
+	Skew float64
+}
+
+// Balance 计算当前环的均衡程度。哈希均匀时，键的分布与哈希空间的划分一致。
+func (r *Ring[V]) Balance() Balance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b := Balance{Shares: make(map[string]float64, len(r.nodes))}
+	if len(r.points) == 0 {
+		return b
+	}
+
+	// 每个虚拟节点拥有从前一个点（不含）到自己（含）的区间，第一个点还拥有环尾绕回来的部分
+	prev := r.points[len(r.points)-1].hash
+	for _, pt := range r.points {
+		b.Shares[pt.node.name] += float64(pt.hash-prev) / math.MaxUint64
+		prev = pt.hash
+	}
+	if len(r.points) == 1 {
+		b.Shares[r.points[0].node.name] = 1
+	}
+
+	total := 0
+	for _, n := range r.nodes {
+		total += n.weight
+	}
+	for name, share := range b.Shares {
+		ideal := float64(r.nodes[name].weight) / float64(total)
+		b.Skew = max(b.Skew, share/ideal)
+	}
+	return b
+}
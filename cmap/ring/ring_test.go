@@ -0,0 +1,324 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"review/cmap"
+	"review/cmap/resp"
+)
+
+func newLocal() Partition[int] {
+	return Local(cmap.New[string, int]())
+}
+
+func fill(t *testing.T, r *Ring[int], n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := r.Put(fmt.Sprint("key", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func owners(t *testing.T, r *Ring[int], n int) map[string]string {
+	t.Helper()
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k := fmt.Sprint("key", i)
+		name, err := r.Locate(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m[k] = name
+	}
+	return m
+}
+
+func expectAll(t *testing.T, r *Ring[int], n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		k := fmt.Sprint("key", i)
+		if v, ok, err := r.Get(k); err != nil || !ok || v != i {
+			t.Fatalf("Get(%s) = %v, %v, %v", k, v, ok, err)
+		}
+	}
+}
+
+func TestEmptyRing(t *testing.T) {
+	r := New[int]()
+	if err := r.Put("k", 1); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("err = %v, want ErrEmpty", err)
+	}
+	if _, err := r.Locate("k"); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("err = %v, want ErrEmpty", err)
+	}
+}
+
+// 新增分区只从原来的归属分区迁走归它所有的键，其他键原地不动
+func TestAddMigratesOnlyAffectedKeys(t *testing.T) {
+	const n = 10000
+	r := New[int]()
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := r.Add(name, 1, newLocal()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fill(t, r, n)
+	before := owners(t, r, n)
+
+	moved, err := r.Add("d", 1, newLocal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := owners(t, r, n)
+
+	changed := 0
+	for k, o := range after {
+		if o != before[k] {
+			changed++
+			if o != "d" {
+				t.Fatalf("%s 从 %s 移到了 %s, 只应该移到新分区", k, before[k], o)
+			}
+		}
+	}
+	if moved != changed {
+		t.Fatalf("迁移了 %d 个键, 归属变化的有 %d 个", moved, changed)
+	}
+	if moved < n/8 || moved > n/2 {
+		t.Fatalf("迁移了 %d 个键, 期望约 %d 个", moved, n/4)
+	}
+	expectAll(t, r, n)
+}
+
+func TestRemoveMigratesOnlyRemovedKeys(t *testing.T) {
+	const n = 10000
+	r := New[int]()
+	parts := map[string]Partition[int]{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		parts[name] = newLocal()
+		r.Add(name, 1, parts[name])
+	}
+	fill(t, r, n)
+	before := owners(t, r, n)
+
+	moved, err := r.Remove("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := owners(t, r, n)
+
+	onB := 0
+	for k, o := range before {
+		if o == "b" {
+			onB++
+			continue
+		}
+		if after[k] != o {
+			t.Fatalf("%s 不在被移除的分区上, 却从 %s 移到了 %s", k, o, after[k])
+		}
+	}
+	if moved != onB {
+		t.Fatalf("迁移了 %d 个键, b 上原有 %d 个", moved, onB)
+	}
+	if err := parts["b"].Range(func(string, int) bool { t.Fatal("被移除的分区应该已经清空"); return false }); err != nil {
+		t.Fatal(err)
+	}
+	expectAll(t, r, n)
+}
+
+func TestRemoveLast(t *testing.T) {
+	r := New[int]()
+	r.Add("a", 1, newLocal())
+	r.Put("k", 1)
+	if _, err := r.Remove("a"); err == nil {
+		t.Fatal("不能移除最后一个非空分区")
+	}
+	r.Delete("k")
+	if _, err := r.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Remove("a"); err == nil {
+		t.Fatal("重复移除应该报错")
+	}
+}
+
+func TestWeightsAndBalance(t *testing.T) {
+	r := New[int]()
+	r.Add("small", 1, newLocal())
+	r.Add("big", 2, newLocal())
+	r.Add("other", 1, newLocal())
+
+	b := r.Balance()
+	sum := 0.0
+	for _, s := range b.Shares {
+		sum += s
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("Shares 之和 = %v", sum)
+	}
+	if b.Skew < 1 || b.Skew > 1.25 {
+		t.Fatalf("Skew = %v, 160 个虚拟节点下应该接近 1", b.Skew)
+	}
+	if ratio := b.Shares["big"] / b.Shares["small"]; ratio < 1.6 || ratio > 2.4 {
+		t.Fatalf("权重 2 的分区拿到 %.2f 倍的空间", ratio)
+	}
+
+	// 虚拟节点越少越不均匀
+	sparse := New[int](WithVirtualNodes(1))
+	sparse.Add("small", 1, newLocal())
+	sparse.Add("big", 2, newLocal())
+	sparse.Add("other", 1, newLocal())
+	if sparse.Balance().Skew <= b.Skew {
+		t.Fatalf("1 个虚拟节点的 Skew %v 不应该好于 160 个的 %v", sparse.Balance().Skew, b.Skew)
+	}
+}
+
+// 两个独立创建的环对键的划分一致
+func TestDeterministic(t *testing.T) {
+	r1, r2 := New[int](), New[int]()
+	for _, name := range []string{"a", "b", "c"} {
+		r1.Add(name, 1, newLocal())
+	}
+	for _, name := range []string{"c", "a", "b"} {
+		r2.Add(name, 1, newLocal())
+	}
+	for i := 0; i < 1000; i++ {
+		k := fmt.Sprint(i)
+		o1, _ := r1.Locate(k)
+		o2, _ := r2.Locate(k)
+		if o1 != o2 {
+			t.Fatalf("%s: %s != %s", k, o1, o2)
+		}
+	}
+}
+
+// 迁移带过期时间的键时保留剩余存活时间，到期后在新分区上同样过期
+func TestMigrationKeepsTTL(t *testing.T) {
+	now := time.Date(2024, 10, 15, 13, 45, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a := cmap.New[string, int](cmap.WithClock(clock))
+	b := cmap.New[string, int](cmap.WithClock(clock))
+
+	r := New[int]()
+	r.Add("a", 1, Local(a))
+	const n = 1000
+	for i := 0; i < n; i++ {
+		a.PutWithTTL(fmt.Sprint("key", i), i, time.Minute)
+	}
+	a.Put("forever", -1)
+
+	now = now.Add(20 * time.Second)
+	moved, err := r.Add("b", 1, Local(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved == 0 || b.Len() != moved {
+		t.Fatalf("迁移了 %d 个键, b 上有 %d 个", moved, b.Len())
+	}
+	b.Range(func(k string, _ int) bool {
+		ttl, ok := b.TTL(k)
+		want := 40 * time.Second
+		if k == "forever" {
+			want = 0
+		}
+		if !ok || ttl != want {
+			t.Fatalf("迁移后 TTL(%s) = %v, %v, want %v", k, ttl, ok, want)
+		}
+		return true
+	})
+
+	now = now.Add(40 * time.Second)
+	for i := 0; i < n; i++ {
+		if _, ok, _ := r.Get(fmt.Sprint("key", i)); ok {
+			t.Fatalf("key%d 迁移后应该按原来的时刻过期", i)
+		}
+	}
+	if _, ok, _ := r.Get("forever"); !ok {
+		t.Fatal("没有过期时间的键不应该过期")
+	}
+}
+
+type failingPartition struct {
+	Partition[int]
+}
+
+func (failingPartition) PutWithTTL(k string, v int, ttl time.Duration) error {
+	return errors.New("disk full")
+}
+
+func TestMigrationFailureRollsBack(t *testing.T) {
+	const n = 1000
+	r := New[int]()
+	r.Add("a", 1, newLocal())
+	r.Add("b", 1, newLocal())
+	fill(t, r, n)
+	before := owners(t, r, n)
+
+	if _, err := r.Add("c", 1, failingPartition{newLocal()}); err == nil {
+		t.Fatal("迁移失败应该返回错误")
+	}
+	if _, err := r.Locate("key0"); err != nil {
+		t.Fatal(err)
+	}
+	for k, o := range owners(t, r, n) {
+		if o != before[k] {
+			t.Fatalf("失败后环应该保持不变, %s 归属 %s", k, o)
+		}
+	}
+	expectAll(t, r, n)
+}
+
+// 分区也可以是通过 RESP 访问的远程 map
+func TestRemotePartition(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	remoteMap := cmap.New[string, string]()
+	go func() {
+		done <- resp.NewServer(remoteMap).Serve(ctx, ln)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	client, err := resp.Dial(ctx, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	r := New[string]()
+	r.Add("local", 1, Local(cmap.New[string, string]()))
+	for i := 0; i < 200; i++ {
+		r.Put(fmt.Sprint(i), fmt.Sprint("v", i))
+	}
+	moved, err := r.Add("remote", 1, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved == 0 || remoteMap.Len() != moved {
+		t.Fatalf("迁移了 %d 个键, 远程有 %d 个", moved, remoteMap.Len())
+	}
+	for i := 0; i < 200; i++ {
+		if v, ok, err := r.Get(fmt.Sprint(i)); err != nil || !ok || v != fmt.Sprint("v", i) {
+			t.Fatalf("Get(%d) = %q, %v, %v", i, v, ok, err)
+		}
+	}
+
+	if _, err := r.Remove("remote"); err != nil {
+		t.Fatal(err)
+	}
+	if remoteMap.Len() != 0 {
+		t.Fatalf("移除后远程还有 %d 个键", remoteMap.Len())
+	}
+}
@@ -0,0 +1,122 @@
+package cmap
+
+import "maps"
+
+// Range 依次对每个未过期的键值对调用 fn，fn 返回 false 时停止遍历。
+//
+// Range 是弱一致的：每个分片内看到的是某一时刻的一致状态，但不同分片的时刻不同，
+// 遍历期间的并发写入可能看得到也可能看不到，每个键最多被访问一次。
+// 每个分片在读锁下把条目复制出来，调用 fn 时不持有任何锁，fn 可以安全地读写同一个 map。
+// 与 Snapshot 不同，Range 不让分片进入写时复制，遍历之后的写入不需要先复制整个分片。
+// 需要跨分片一致的视图请用 Snapshot。
+func (m *ConcurrentMap[K, V]) Range(fn func(k K, v V) bool) {
+	var items []kv[K, V]
+	for _, s := range m.shards {
+		now := m.nowNano()
+		items = items[:0]
+		s.mu.RLock()
+		for k, e := range s.data {
+			if !e.expired(now) {
+				items = append(items, kv[K, V]{k, e.value})
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, it := range items {
+			if !fn(it.k, it.v) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot 是 map 在某一时刻的只读视图，创建后不受后续写入影响，可以在任意 goroutine 中使用。
+type Snapshot[K comparable, V any] struct {
+	m      *ConcurrentMap[K, V]
+	shards []map[K]entry[V]
+	now    int64
+	rev    uint64
+}
+
+// Snapshot 创建一个跨所有分片一致的时间点快照。
+// 创建时按顺序短暂锁住所有分片，只记录各分片 data 的引用而不复制；
+// 之后哪个分片先被写入，哪个分片才复制一份（写时复制），长时间导出也不会阻塞写入者。
+func (m *ConcurrentMap[K, V]) Snapshot() *Snapshot[K, V] {
+	return m.snapshot(nil)
+}
+
+// snapshot 在锁住所有分片期间额外执行 during，此时没有任何写入在进行，
+// 可以用来记录与快照严格对应的外部状态（例如 WAL 的切分点）。
+func (m *ConcurrentMap[K, V]) snapshot(during func()) *Snapshot[K, V] {
+	snap := &Snapshot[K, V]{
+		m:      m,
+		shards: make([]map[K]entry[V], len(m.shards)),
+	}
+
+	m.lockAll()
+	snap.now = m.nowNano()
+	snap.rev = m.rev.Load()
+	for i, s := range m.shards {
+		snap.shards[i] = s.share()
+	}
+	if during != nil {
+		during()
+	}
+	m.unlockAll()
+	return snap
+}
+
+// Get 读取快照中的值，快照时刻已过期的条目视为不存在。
+func (snap *Snapshot[K, V]) Get(k K) (v V, ok bool) {
+	e, ok := snap.shards[snap.m.shardIndex(k)][k]
+	if !ok || e.expired(snap.now) {
+		return v, false
+	}
+	return e.value, true
+}
+
+// Len 返回快照中未过期的条目数。
+func (snap *Snapshot[K, V]) Len() int {
+	n := 0
+	for _, data := range snap.shards {
+		for _, e := range data {
+			if !e.expired(snap.now) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Rev 返回快照时刻 map 的全局写入版本号。
+func (snap *Snapshot[K, V]) Rev() uint64 {
+	return snap.rev
+}
+
+// Range 遍历快照中的条目，fn 返回 false 时停止。
+func (snap *Snapshot[K, V]) Range(fn func(k K, v V) bool) {
+	for _, data := range snap.shards {
+		for k, e := range data {
+			if e.expired(snap.now) {
+				continue
+			}
+			if !fn(k, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// share 把当前 data 交给调用方只读使用，调用方需持有 s.mu 写锁。
+func (s *shard[K, V]) share() map[K]entry[V] {
+	s.shared = true
+	return s.data
+}
+
+// own 在写入前确保 data 没有被快照引用，调用方需持有 s.mu 写锁。
+func (s *shard[K, V]) own() {
+	if s.shared {
+		s.data = maps.Clone(s.data)
+		s.shared = false
+	}
+}
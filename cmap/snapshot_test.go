@@ -0,0 +1,155 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRange(t *testing.T) {
+	clock := newFakeClock()
+	m := New[int, int](WithClock(clock.Now))
+	for i := 0; i < 100; i++ {
+		m.Put(i, i*2)
+	}
+	m.PutWithTTL(1000, 1, time.Second)
+	clock.Advance(time.Second)
+
+	seen := map[int]int{}
+	m.Range(func(k, v int) bool {
+		seen[k] = v
+		return true
+	})
+	if len(seen) != 100 {
+		t.Fatalf("遍历到 %d 个键, want 100（过期条目不应出现）", len(seen))
+	}
+	for k, v := range seen {
+		if v != k*2 {
+			t.Fatalf("seen[%d] = %d", k, v)
+		}
+	}
+
+	n := 0
+	m.Range(func(k, v int) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Fatalf("fn 返回 false 后应该停止, n = %d", n)
+	}
+}
+
+// fn 中写入同一个 map 不会死锁
+func TestRangeWriteInCallback(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	m.Range(func(k, v int) bool {
+		m.Put(k, v+1)
+		m.Delete(k + 1000)
+		return true
+	})
+	m.Range(func(k, v int) bool {
+		if v != k+1 {
+			t.Fatalf("Get(%d) = %d", k, v)
+		}
+		return true
+	})
+}
+
+// Range 不应该让分片进入写时复制，否则遍历之后的每个分片的第一次写入都要复制整个分片
+func TestRangeDoesNotShare(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 1000; i++ {
+		m.Put(i, i)
+	}
+	m.Range(func(k, v int) bool { return true })
+	for i, s := range m.shards {
+		if s.shared {
+			t.Fatalf("Range 之后分片 %d 被标记为共享", i)
+		}
+	}
+
+	m.Snapshot()
+	for i, s := range m.shards {
+		if !s.shared {
+			t.Fatalf("Snapshot 之后分片 %d 应该被标记为共享", i)
+		}
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	m := New[string, int]()
+	m.Put("a", 1)
+	m.Put("b", 2)
+
+	snap := m.Snapshot()
+	m.Put("a", 100)
+	m.Delete("b")
+	m.Put("c", 3)
+
+	if v, _ := snap.Get("a"); v != 1 {
+		t.Fatalf("快照中 a = %d, want 1", v)
+	}
+	if v, ok := snap.Get("b"); !ok || v != 2 {
+		t.Fatal("快照中 b 应该仍然存在")
+	}
+	if _, ok := snap.Get("c"); ok {
+		t.Fatal("快照之后写入的 c 不应该出现")
+	}
+	if n := snap.Len(); n != 2 {
+		t.Fatalf("快照 Len() = %d, want 2", n)
+	}
+	if v, _ := m.Get("a"); v != 100 {
+		t.Fatalf("map 中 a = %d, want 100", v)
+	}
+}
+
+func TestSnapshotRev(t *testing.T) {
+	m := New[string, int]()
+	m.Put("a", 1)
+	m.Put("a", 2)
+	if rev := m.Snapshot().Rev(); rev != 2 {
+		t.Fatalf("Rev() = %d, want 2", rev)
+	}
+}
+
+// 导出快照期间写入者不被阻塞，快照始终是某一时刻的一致视图：
+// 所有写入都保持 a + b == 0，快照中也必须如此
+func TestSnapshotConsistentUnderWrites(t *testing.T) {
+	m := New[string, int](WithShardCount(64))
+	m.Put("a", 0)
+	m.Put("b", 0)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			m.Update(func(tx *Txn[string, int]) error {
+				tx.Put("a", i)
+				tx.Put("b", -i)
+				return nil
+			})
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		snap := m.Snapshot()
+		a, _ := snap.Get("a")
+		b, _ := snap.Get("b")
+		if a+b != 0 {
+			t.Fatalf("快照不一致: a = %d, b = %d", a, b)
+		}
+		snap.Range(func(k string, v int) bool { return true })
+	}
+	close(stop)
+	wg.Wait()
+}
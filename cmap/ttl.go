@@ -0,0 +1,112 @@
+package cmap
+
+import (
+	"context"
+	"time"
+)
+
+// WithClock 替换 map 使用的时钟，测试中可以用假时钟驱动过期而不必真的 sleep。
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// SetOnEvict 设置条目因过期或容量淘汰被移除时的回调，fn 为 nil 时取消。
+// 回调在分片锁之外执行，可以安全地访问 map。可以在任何时候调用，之后发生的移除使用新的回调。
+func (m *ConcurrentMap[K, V]) SetOnEvict(fn func(k K, v V)) {
+	if fn == nil {
+		m.onEvict.Store(nil)
+		return
+	}
+	m.onEvict.Store(&fn)
+}
+
+// PutWithTTL 写入一个在 ttl 之后过期的键值对，ttl <= 0 表示永不过期。
+func (m *ConcurrentMap[K, V]) PutWithTTL(k K, v V, ttl time.Duration) {
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = m.now().Add(ttl).UnixNano()
+	}
+
+	s := m.shardFor(k)
+	s.mu.Lock()
+	evicted := s.set(k, v, expireAt)
+	s.mu.Unlock()
+
+	m.notifyEvict(evicted)
+}
+
+// TTL 返回键的剩余存活时间，0 表示永不过期；键不存在或已过期时 ok 为 false。
+func (m *ConcurrentMap[K, V]) TTL(k K) (ttl time.Duration, ok bool) {
+	now := m.nowNano()
+	s := m.shardFor(k)
+	s.mu.RLock()
+	e, ok := s.data[k]
+	s.mu.RUnlock()
+	if !ok || e.expired(now) {
+		return 0, false
+	}
+	if e.expireAt == 0 {
+		return 0, true
+	}
+	return time.Duration(e.expireAt - now), true
+}
+
+// DeleteExpired 立即清理所有已过期的条目，返回清理的数量。
+func (m *ConcurrentMap[K, V]) DeleteExpired() int {
+	now := m.nowNano()
+	n := 0
+	for _, s := range m.shards {
+		var evicted []kv[K, V]
+
+		s.mu.Lock()
+		for k, e := range s.data {
+			if e.expired(now) {
+				s.del(k)
+				evicted = append(evicted, kv[K, V]{k, e.value})
+			}
+		}
+		s.mu.Unlock()
+
+		n += len(evicted)
+		s.expirations.Add(uint64(len(evicted)))
+		m.notifyEvict(evicted)
+	}
+	return n
+}
+
+// StartJanitor 启动一个后台 goroutine，每隔 interval 清理一次过期条目，ctx 结束时退出。
+func (m *ConcurrentMap[K, V]) StartJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		m.runJanitor(ctx, ticker.C)
+	}()
+}
+
+func (m *ConcurrentMap[K, V]) runJanitor(ctx context.Context, tick <-chan time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			m.DeleteExpired()
+		}
+	}
+}
+
+// removeExpired 在写锁下复查并删除过期的键，Get 发现过期条目时调用。
+func (m *ConcurrentMap[K, V]) removeExpired(s *shard[K, V], k K, now int64) {
+	s.mu.Lock()
+	e, ok := s.data[k]
+	if !ok || !e.expired(now) {
+		s.mu.Unlock()
+		return
+	}
+	s.del(k)
+	s.mu.Unlock()
+
+	s.expirations.Add(1)
+	m.notifyEvict([]kv[K, V]{{k, e.value}})
+}
@@ -0,0 +1,165 @@
+package cmap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟，过期相关的测试不需要真的等待
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 10, 15, 13, 45, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestPutWithTTL(t *testing.T) {
+	clock := newFakeClock()
+	var evicted []string
+	m := New[string, int](WithClock(clock.Now))
+	m.SetOnEvict(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+
+	m.PutWithTTL("session", 1, time.Minute)
+	m.PutWithTTL("forever", 2, 0)
+	m.Put("plain", 3)
+
+	clock.Advance(59 * time.Second)
+	if _, ok := m.Get("session"); !ok {
+		t.Fatal("未到期的条目不应该过期")
+	}
+
+	clock.Advance(time.Second)
+	if _, ok := m.Get("session"); ok {
+		t.Fatal("到期的条目应该读不到")
+	}
+	if len(evicted) != 1 || evicted[0] != "session" {
+		t.Fatalf("evicted = %v, want [session]", evicted)
+	}
+	if n := m.Len(); n != 2 {
+		t.Fatalf("惰性过期后 Len() = %d, want 2", n)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if _, ok := m.Get("forever"); !ok {
+		t.Fatal("ttl <= 0 应该永不过期")
+	}
+	if _, ok := m.Get("plain"); !ok {
+		t.Fatal("Put 写入的条目不应该过期")
+	}
+}
+
+func TestPutOverridesTTL(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+
+	m.PutWithTTL("k", 1, time.Second)
+	m.Put("k", 2)
+	clock.Advance(time.Hour)
+	if v, ok := m.Get("k"); !ok || v != 2 {
+		t.Fatalf("Get(k) = %v, %v, 重新 Put 后应该不再过期", v, ok)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+
+	m.PutWithTTL("session", 1, time.Minute)
+	m.Put("plain", 2)
+	clock.Advance(20 * time.Second)
+	if ttl, ok := m.TTL("session"); !ok || ttl != 40*time.Second {
+		t.Fatalf("TTL(session) = %v, %v, want 40s", ttl, ok)
+	}
+	if ttl, ok := m.TTL("plain"); !ok || ttl != 0 {
+		t.Fatalf("TTL(plain) = %v, %v, want 0, true", ttl, ok)
+	}
+	if _, ok := m.TTL("missing"); ok {
+		t.Fatal("不存在的键 TTL 应该返回 false")
+	}
+	clock.Advance(40 * time.Second)
+	if _, ok := m.TTL("session"); ok {
+		t.Fatal("过期的键 TTL 应该返回 false")
+	}
+}
+
+func TestDeleteExpiredEntry(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+
+	m.PutWithTTL("k", 1, time.Second)
+	clock.Advance(time.Second)
+	if m.Delete("k") {
+		t.Fatal("删除已过期的键应该返回 false")
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	clock := newFakeClock()
+	evicted := make(chan string, 10)
+	m := New[string, int](WithClock(clock.Now))
+	m.SetOnEvict(func(k string, v int) {
+		evicted <- k
+	})
+
+	for _, k := range []string{"a", "b", "c"} {
+		m.PutWithTTL(k, 1, time.Minute)
+	}
+	m.PutWithTTL("d", 1, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tick := make(chan time.Time)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		m.runJanitor(ctx, tick)
+	}()
+
+	clock.Advance(time.Minute)
+	tick <- clock.Now()
+
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		got[<-evicted] = true
+	}
+	if !got["a"] || !got["b"] || !got["c"] {
+		t.Fatalf("evicted = %v", got)
+	}
+
+	cancel()
+	<-stopped
+	if n := m.Len(); n != 1 {
+		t.Fatalf("Len() = %d, want 1", n)
+	}
+}
+
+func TestWaitForIgnoresExpired(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+
+	m.PutWithTTL("k", 1, time.Second)
+	clock.Advance(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.WaitFor(ctx, "k"); err != ErrTimeout {
+		t.Fatalf("err = %v, 过期条目不应该被 WaitFor 返回", err)
+	}
+}
@@ -0,0 +1,203 @@
+package cmap
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrConflict 表示事务读过的键在提交前被其他写入修改了。
+var ErrConflict = errors.New("cmap: 事务冲突")
+
+// ErrTxnDone 表示事务已经提交过。
+var ErrTxnDone = errors.New("cmap: 事务已结束")
+
+// Txn 是跨多个键的乐观事务：Get 记录读到的版本，Put/Delete 只暂存在本地，
+// Commit 时按分片下标从小到大依次加锁，校验读集合的版本没有变化后一次性写入。
+// 所有事务都按同一顺序加锁，不会出现 TestDeadLock 中两个 goroutine 反序加锁互相等待的情况。
+// 校验失败时不会写入任何键，返回 ErrConflict，调用方可以重试。
+// Txn 不是并发安全的，只能在一个 goroutine 中使用。
+type Txn[K comparable, V any] struct {
+	m      *ConcurrentMap[K, V]
+	reads  map[K]uint64 // 键第一次被读到时的版本，0 表示不存在
+	writes map[K]txnWrite[V]
+	done   bool
+}
+
+type txnWrite[V any] struct {
+	value V
+	del   bool
+}
+
+// Txn 开始一个新事务。
+func (m *ConcurrentMap[K, V]) Txn() *Txn[K, V] {
+	return &Txn[K, V]{
+		m:      m,
+		reads:  make(map[K]uint64),
+		writes: make(map[K]txnWrite[V]),
+	}
+}
+
+// Get 读取键，优先返回本事务暂存的写入，并记录读到的版本用于提交时校验。
+func (t *Txn[K, V]) Get(k K) (v V, ok bool) {
+	if w, staged := t.writes[k]; staged {
+		if w.del {
+			return v, false
+		}
+		return w.value, true
+	}
+
+	s := t.m.shardFor(k)
+	now := t.m.nowNano()
+	s.mu.RLock()
+	e, ok := s.data[k]
+	s.mu.RUnlock()
+
+	var rev uint64
+	if ok && !e.expired(now) {
+		v, rev = e.value, e.rev
+	} else {
+		ok = false
+	}
+	if _, seen := t.reads[k]; !seen {
+		t.reads[k] = rev
+	}
+	return v, ok
+}
+
+// Put 暂存一次写入，提交后才对其他 goroutine 可见。
+func (t *Txn[K, V]) Put(k K, v V) {
+	t.writes[k] = txnWrite[V]{value: v}
+}
+
+// Delete 暂存一次删除。
+func (t *Txn[K, V]) Delete(k K) {
+	t.writes[k] = txnWrite[V]{del: true}
+}
+
+// Commit 原子地提交事务，读过的任何键被并发修改时返回 ErrConflict 且不写入任何键。
+// map 开启了 WAL 或复制时，所有写入合成的记录超过单帧上限会返回 ErrTooLarge，同样不写入任何键。
+func (t *Txn[K, V]) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+	m := t.m
+	if err := t.checkSize(); err != nil {
+		return err
+	}
+
+	keys := make([]K, 0, len(t.reads)+len(t.writes))
+	for k := range t.reads {
+		keys = append(keys, k)
+	}
+	for k := range t.writes {
+		keys = append(keys, k)
+	}
+	order := m.lockShards(keys)
+	var evicted []kv[K, V]
+	defer func() {
+		m.unlockShards(order)
+		m.notifyEvict(evicted)
+	}()
+
+	now := m.nowNano()
+	for k, rev := range t.reads {
+		var cur uint64
+		if e, ok := m.shardFor(k).loadLive(k, now, &evicted); ok {
+			cur = e.rev
+		}
+		if cur != rev {
+			return ErrConflict
+		}
+	}
+
+	// 所有写入（包括因此淘汰的条目）合成一条记录写入 WAL 和复制流，崩溃恢复和副本不会只看到一部分
+	var batch []walRecord[K, V]
+	for _, i := range order {
+		m.shards[i].batch = &batch
+	}
+	for k, w := range t.writes {
+		s := m.shardFor(k)
+		if w.del {
+			s.del(k)
+			continue
+		}
+		evicted = append(evicted, s.set(k, w.value, 0)...)
+	}
+	for _, i := range order {
+		m.shards[i].batch = nil
+	}
+	if len(batch) > 0 {
+		m.logRecord(walRecord[K, V]{Op: opBatch, Batch: batch}, nil)
+	}
+	return nil
+}
+
+// checkSize 在加锁之前检查事务的写入能否编码成一帧。
+// 有容量上限的 map 在提交时因淘汰追加的删除记录不在检查之内。
+func (t *Txn[K, V]) checkSize() error {
+	m := t.m
+	if m.wal == nil && m.repl.Load() == nil {
+		return nil
+	}
+	batch := make([]walRecord[K, V], 0, len(t.writes))
+	for k, w := range t.writes {
+		if w.del {
+			batch = append(batch, walRecord[K, V]{Op: opDelete, Key: k})
+		} else {
+			batch = append(batch, walRecord[K, V]{Op: opPut, Key: k, Value: w.value})
+		}
+	}
+	_, err := encodeRecord(walRecord[K, V]{Op: opBatch, Batch: batch})
+	return err
+}
+
+// lockShards 按下标从小到大锁住 keys 所在的分片，返回加锁顺序，交给 unlockShards 解锁。
+func (m *ConcurrentMap[K, V]) lockShards(keys []K) []int {
+	idx := make(map[int]struct{})
+	for _, k := range keys {
+		idx[m.shardIndex(k)] = struct{}{}
+	}
+	order := make([]int, 0, len(idx))
+	for i := range idx {
+		order = append(order, i)
+	}
+	sort.Ints(order)
+	for _, i := range order {
+		m.shards[i].mu.Lock()
+	}
+	return order
+}
+
+func (m *ConcurrentMap[K, V]) unlockShards(order []int) {
+	for i := len(order) - 1; i >= 0; i-- {
+		m.shards[order[i]].mu.Unlock()
+	}
+}
+
+// lockAll 按下标顺序锁住所有分片，与 lockShards 的顺序一致，期间没有任何写入在进行。
+func (m *ConcurrentMap[K, V]) lockAll() {
+	for _, s := range m.shards {
+		s.mu.Lock()
+	}
+}
+
+func (m *ConcurrentMap[K, V]) unlockAll() {
+	for i := len(m.shards) - 1; i >= 0; i-- {
+		m.shards[i].mu.Unlock()
+	}
+}
+
+// Update 在事务中执行 fn 并提交，遇到 ErrConflict 时用新事务重试，直到成功或 fn 返回错误。
+func (m *ConcurrentMap[K, V]) Update(fn func(tx *Txn[K, V]) error) error {
+	for {
+		tx := m.Txn()
+		if err := fn(tx); err != nil {
+			return err
+		}
+		err := tx.Commit()
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+}
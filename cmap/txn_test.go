@@ -0,0 +1,165 @@
+package cmap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTxnCommit(t *testing.T) {
+	m := New[string, int]()
+	m.Put("a", 10)
+	m.Put("b", 5)
+
+	tx := m.Txn()
+	a, _ := tx.Get("a")
+	b, _ := tx.Get("b")
+	tx.Put("a", a-3)
+	tx.Put("b", b+3)
+	tx.Delete("c")
+	tx.Put("d", 1)
+
+	// 提交前对外不可见，本事务内可以读到自己的写入
+	if v, _ := m.Get("a"); v != 10 {
+		t.Fatalf("提交前 a = %d, want 10", v)
+	}
+	if v, _ := tx.Get("a"); v != 7 {
+		t.Fatalf("事务内 a = %d, want 7", v)
+	}
+	if _, ok := tx.Get("c"); ok {
+		t.Fatal("事务内删除的键应该读不到")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get("a"); v != 7 {
+		t.Fatalf("a = %d, want 7", v)
+	}
+	if v, _ := m.Get("b"); v != 8 {
+		t.Fatalf("b = %d, want 8", v)
+	}
+	if v, _ := m.Get("d"); v != 1 {
+		t.Fatalf("d = %d, want 1", v)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTxnDone) {
+		t.Fatalf("重复提交 err = %v", err)
+	}
+}
+
+func TestTxnConflict(t *testing.T) {
+	m := New[string, int]()
+	m.Put("a", 1)
+
+	tx := m.Txn()
+	v, _ := tx.Get("a")
+	tx.Get("missing")
+	tx.Put("b", v)
+
+	m.Put("a", 2) // 并发修改读集合中的键
+
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("err = %v, want ErrConflict", err)
+	}
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("冲突的事务不应该写入任何键")
+	}
+
+	// 读到不存在的键后该键被写入同样算冲突
+	tx = m.Txn()
+	tx.Get("missing")
+	tx.Put("b", 1)
+	m.Put("missing", 1)
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("err = %v, want ErrConflict", err)
+	}
+}
+
+func TestTxnExpiredReadsAsMissing(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+	m.PutWithTTL("a", 1, time.Second)
+
+	tx := m.Txn()
+	clock.Advance(time.Second)
+	if _, ok := tx.Get("a"); ok {
+		t.Fatal("过期的键应该读不到")
+	}
+	tx.Put("a", 2)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 对应 TestDeadLock：两组 goroutine 以相反的顺序在 a、b 之间转账，
+// 统一的加锁顺序保证不会死锁，乐观校验保证总额不变
+func TestTxnOppositeOrderTransfers(t *testing.T) {
+	m := New[string, int](WithShardCount(64))
+	m.Put("a", 1000)
+	m.Put("b", 1000)
+
+	transfer := func(from, to string) error {
+		return m.Update(func(tx *Txn[string, int]) error {
+			f, _ := tx.Get(from)
+			d, _ := tx.Get(to)
+			tx.Put(from, f-1)
+			tx.Put(to, d+1)
+			return nil
+		})
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if err := transfer("a", "b"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := transfer("b", "a"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("转账死锁")
+	}
+
+	a, _ := m.Get("a")
+	b, _ := m.Get("b")
+	if a+b != 2000 || a != 1000-8*100 {
+		t.Fatalf("a = %d, b = %d", a, b)
+	}
+}
+
+func TestUpdateReturnsFnError(t *testing.T) {
+	m := New[string, int]()
+	wantErr := errors.New("余额不足")
+
+	err := m.Update(func(tx *Txn[string, int]) error {
+		tx.Put("a", 1)
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("err = %v", err)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("fn 返回错误时不应该提交")
+	}
+}
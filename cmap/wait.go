@@ -0,0 +1,79 @@
+package cmap
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTimeout 表示等待键出现时超时，errors.Is(err, context.DeadlineExceeded) 同样成立。
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string     { return "cmap: 等待键超时" }
+func (timeoutError) Timeout() bool     { return true }
+func (timeoutError) Is(err error) bool { return err == context.DeadlineExceeded }
+
+// waitSlot 是某个键上所有等待者共享的唤醒点，Put 时写入值后关闭 done。
+type waitSlot[V any] struct {
+	done    chan struct{}
+	v       V
+	waiters int
+}
+
+// WaitFor 阻塞直到键 k 被写入或 ctx 结束。键已存在时立即返回。
+// 任意多个 goroutine 可以同时等待同一个或不同的键，每个等待者只会被自己的键唤醒。
+// ctx 超时返回 ErrTimeout，被取消返回 ctx.Err()。
+func (m *ConcurrentMap[K, V]) WaitFor(ctx context.Context, k K) (V, error) {
+	if v, ok := m.Get(k); ok {
+		return v, nil
+	}
+
+	s := m.shardFor(k)
+	s.mu.Lock()
+	if v, ok := s.lookup(k, m.nowNano()); ok {
+		s.mu.Unlock()
+		return v, nil
+	}
+	if s.waiters == nil {
+		s.waiters = make(map[K]*waitSlot[V])
+	}
+	slot, ok := s.waiters[k]
+	if !ok {
+		slot = &waitSlot[V]{done: make(chan struct{})}
+		s.waiters[k] = slot
+	}
+	slot.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-slot.done:
+		return slot.v, nil
+	case <-ctx.Done():
+	}
+
+	// 放弃等待：最后一个等待者负责清理，避免键永远不出现时 slot 泄漏
+	s.mu.Lock()
+	slot.waiters--
+	if slot.waiters == 0 && s.waiters[k] == slot {
+		delete(s.waiters, k)
+	}
+	s.mu.Unlock()
+
+	var zero V
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return zero, ErrTimeout
+	}
+	return zero, ctx.Err()
+}
+
+// wake 唤醒等待键 k 的所有 goroutine，调用方需持有 s.mu 写锁。
+func (s *shard[K, V]) wake(k K, v V) {
+	slot, ok := s.waiters[k]
+	if !ok {
+		return
+	}
+	delete(s.waiters, k)
+	slot.v = v
+	close(slot.done)
+}
@@ -0,0 +1,106 @@
+package cmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitForExistingKey(t *testing.T) {
+	m := New[string, int]()
+	m.Put("a", 1)
+
+	v, err := m.WaitFor(context.Background(), "a")
+	if err != nil || v != 1 {
+		t.Fatalf("WaitFor(a) = %v, %v", v, err)
+	}
+}
+
+// 多个 goroutine 等待不同的键，每个只被自己的键唤醒，写入别的键不会被吞掉
+func TestWaitForManyKeys(t *testing.T) {
+	m := New[int, int](WithShardCount(1)) // 所有键落在同一个分片，更容易暴露串键
+
+	const keys, perKey = 10, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, keys*perKey)
+	for k := 0; k < keys; k++ {
+		for i := 0; i < perKey; i++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				v, err := m.WaitFor(context.Background(), k)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if v != k*10 {
+					errs <- errors.New("拿到了别的键的值")
+				}
+			}(k)
+		}
+	}
+
+	// 等所有等待者都登记好
+	for {
+		m.shards[0].mu.RLock()
+		n := 0
+		for _, slot := range m.shards[0].waiters {
+			n += slot.waiters
+		}
+		m.shards[0].mu.RUnlock()
+		if n == keys*perKey {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for k := keys - 1; k >= 0; k-- {
+		m.Put(k, k*10)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	for k := 0; k < keys; k++ {
+		if v, ok := m.Get(k); !ok || v != k*10 {
+			t.Fatalf("Get(%d) = %v, %v", k, v, ok)
+		}
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	m := New[string, int]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := m.WaitFor(ctx, "missing")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("ErrTimeout 应该匹配 context.DeadlineExceeded")
+	}
+	if len(m.shardFor("missing").waiters) != 0 {
+		t.Fatal("超时后等待槽没有被清理")
+	}
+}
+
+func TestWaitForCancel(t *testing.T) {
+	m := New[string, int]()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := m.WaitFor(ctx, "k")
+		done <- err
+	}()
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
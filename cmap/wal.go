@@ -0,0 +1,605 @@
+package cmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 磁盘格式：每条记录是一帧 [4 字节长度][4 字节 CRC32-C][JSON 负载]。
+// WAL 按段存放在 wal-<序号>.log 中，压缩时写出 snapshot 文件并删除已被快照覆盖的段。
+// 一帧的负载不能超过 maxFrameSize，读取时更大的长度被当作损坏的尾部，所以写入时就拒绝超限的记录，
+// 见 ErrTooLarge。
+// 事务提交的所有写入合成一条 batch 帧，崩溃时要么整条重放，要么作为不完整的尾部整条截掉。
+// snapshot 文件由 begin 帧（记录从哪个段开始重放）、若干 put 帧和 end 帧（记录条目数）组成。
+
+const (
+	opPut byte = iota + 1
+	opDelete
+	opSnapshotBegin
+	opSnapshotEnd
+	opBatch
+)
+
+const (
+	snapshotFile  = "snapshot"
+	segmentPrefix = "wal-"
+	segmentSuffix = ".log"
+)
+
+// maxFrameSize 是一帧负载的上限，测试中调小。写入 WAL 和复制流的记录还要再小 frameHeadroom，
+// 给复制帧附加的偏移和复制 ID 留出余量，保证同一条记录在复制时也不会超限。
+var maxFrameSize = 64 << 20
+
+const frameHeadroom = 1 << 10
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt 表示快照或非末尾的 WAL 段损坏，无法安全恢复。
+var ErrCorrupt = errors.New("cmap: 持久化文件损坏")
+
+// ErrNotPersistent 表示 map 不是通过 Open 创建的，没有 WAL。
+var ErrNotPersistent = errors.New("cmap: map 没有开启持久化")
+
+// ErrTooLarge 表示一次写入编码后超过了单帧上限（约 64 MiB），无法写入 WAL 或复制流。
+// 这样的写入被拒绝，map 保持不变；持久化的 map 由 Sync 和 Close 返回这个错误，Txn.Commit 直接返回它。
+var ErrTooLarge = errors.New("cmap: 记录超过单帧上限")
+
+var errWALClosed = errors.New("cmap: WAL 已关闭")
+
+// errTornTail 表示读到了不完整或校验失败的帧，通常是写到一半时崩溃留下的尾巴。
+var errTornTail = errors.New("cmap: WAL 尾部不完整")
+
+// FsyncPolicy 决定 WAL 何时调用 fsync。
+type FsyncPolicy int
+
+const (
+	// FsyncInterval 每隔一段时间 fsync 一次（默认每秒），崩溃最多丢失这段时间内的写入。
+	FsyncInterval FsyncPolicy = iota
+	// FsyncAlways 每条记录写入后立即 fsync，最安全也最慢。
+	FsyncAlways
+	// FsyncNever 从不主动 fsync，交给操作系统刷盘。
+	FsyncNever
+)
+
+// WithFsync 设置 WAL 的 fsync 策略，只对 Open 创建的 map 生效。
+func WithFsync(p FsyncPolicy) Option {
+	return func(o *options) {
+		o.fsync = p
+	}
+}
+
+// WithFsyncInterval 设置 FsyncInterval 策略下的刷盘间隔，默认 1 秒。
+func WithFsyncInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.fsyncInterval = d
+	}
+}
+
+// WithCompactInterval 开启后台定期压缩：写出快照并删除旧的 WAL 段。
+func WithCompactInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.compactInterval = d
+	}
+}
+
+type walRecord[K comparable, V any] struct {
+	Op       byte   `json:"op"`
+	Key      K      `json:"k"`
+	Value    V      `json:"v"`
+	ExpireAt int64  `json:"e,omitempty"`
+	Seg      uint64 `json:"s,omitempty"`
+	Count    int    `json:"n,omitempty"`
+	// Batch 是 opBatch 记录包含的写入，按提交时的顺序
+	Batch []walRecord[K, V] `json:"b,omitempty"`
+}
+
+type wal[K comparable, V any] struct {
+	dir    string
+	policy FsyncPolicy
+
+	mu    sync.Mutex
+	f     *os.File
+	seq   uint64
+	dirty bool
+	err   error // 写入失败后的粘滞错误，Close 时返回
+	// rejected 是第一次因超过上限被拒绝的写入的错误，Sync 和 Close 时返回。
+	// 被拒绝的写入没有生效，WAL 与 map 仍然一致，所以不影响之后的写入
+	rejected error
+
+	compactMu  sync.Mutex
+	compactErr error
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open 打开（或创建）dir 下持久化的 map：先加载快照，再按顺序重放之后的 WAL 段。
+// 最后一个段尾部不完整或校验失败的记录会被截掉，之前的数据照常恢复。
+// 之后所有写入、删除、过期和淘汰都会追加到 WAL；用完后必须调用 Close。
+// 键和值用 encoding/json 编码，必须能被 JSON 往返。
+func Open[K comparable, V any](dir string, opts ...Option) (*ConcurrentMap[K, V], error) {
+	o := options{shardCount: defaultShardCount, now: time.Now, fsyncInterval: time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	m := newMap[K, V](o)
+	nextSeg, err := m.loadSnapshot(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+
+	segs, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	active := nextSeg
+	for i, seq := range segs {
+		path := segmentPath(dir, seq)
+		if seq < nextSeg {
+			// 压缩写完快照后、删除旧段前崩溃留下的段，内容已包含在快照中
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		off, err := m.replaySegment(path)
+		if errors.Is(err, errTornTail) {
+			if i != len(segs)-1 {
+				return nil, fmt.Errorf("%w: %s 偏移 %d", ErrCorrupt, path, off)
+			}
+			err = os.Truncate(path, off)
+		}
+		if err != nil {
+			return nil, err
+		}
+		active = seq
+	}
+
+	f, err := openSegment(dir, active)
+	if err != nil {
+		return nil, err
+	}
+	w := &wal[K, V]{
+		dir:    dir,
+		policy: o.fsync,
+		f:      f,
+		seq:    active,
+		stop:   make(chan struct{}),
+	}
+	m.wal = w
+
+	if o.fsync == FsyncInterval && o.fsyncInterval > 0 {
+		w.every(o.fsyncInterval, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.syncLocked()
+		})
+	}
+	if o.compactInterval > 0 {
+		w.every(o.compactInterval, func() {
+			if err := m.Compact(); err != nil {
+				w.mu.Lock()
+				w.compactErr = err
+				w.mu.Unlock()
+			}
+		})
+	}
+	return m, nil
+}
+
+// Sync 把 WAL 刷到磁盘，并返回此前写 WAL 时遇到的错误。
+func (m *ConcurrentMap[K, V]) Sync() error {
+	w := m.wal
+	if w == nil {
+		return ErrNotPersistent
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.syncLocked()
+	return errors.Join(w.err, w.rejected)
+}
+
+// Close 停止后台任务，刷盘并关闭 WAL。对没有持久化的 map 是空操作。
+func (m *ConcurrentMap[K, V]) Close() error {
+	w := m.wal
+	if w == nil {
+		return nil
+	}
+
+	select {
+	case <-w.stop:
+		return errWALClosed
+	default:
+		close(w.stop)
+	}
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.syncLocked()
+	closeErr := w.f.Close()
+	w.f = nil
+	return errors.Join(w.err, w.rejected, w.compactErr, closeErr)
+}
+
+// Compact 写出当前内容的快照并删除被快照覆盖的 WAL 段。
+// 快照与 WAL 的切分点在锁住所有分片时确定，二者严格对应，不会丢失或重复写入。
+func (m *ConcurrentMap[K, V]) Compact() error {
+	w := m.wal
+	if w == nil {
+		return ErrNotPersistent
+	}
+	w.compactMu.Lock()
+	defer w.compactMu.Unlock()
+
+	var seq uint64
+	var rotateErr error
+	snap := m.snapshot(func() {
+		seq, rotateErr = w.rotate()
+	})
+	if rotateErr != nil {
+		return rotateErr
+	}
+
+	if err := writeSnapshot(w.dir, snap, seq); err != nil {
+		return err
+	}
+
+	segs, err := listSegments(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range segs {
+		if s < seq {
+			if err := os.Remove(segmentPath(w.dir, s)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *wal[K, V]) append(rec walRecord[K, V]) {
+	frame, err := encodeRecord(rec)
+	if err != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	w.appendFrame(frame)
+}
+
+func (w *wal[K, V]) appendFrame(frame []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+	if w.f == nil {
+		w.err = errWALClosed
+		return
+	}
+	if _, err := w.f.Write(frame); err != nil {
+		w.err = err
+		return
+	}
+	w.dirty = true
+	if w.policy == FsyncAlways {
+		w.syncLocked()
+	}
+}
+
+func (w *wal[K, V]) syncLocked() {
+	if !w.dirty || w.f == nil {
+		return
+	}
+	if err := w.f.Sync(); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.dirty = false
+}
+
+// rotate 关闭当前段并切换到下一个段，返回新段的序号。
+func (w *wal[K, V]) rotate() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, errWALClosed
+	}
+	w.syncLocked()
+	err := w.f.Close()
+	var f *os.File
+	if err == nil {
+		f, err = openSegment(w.dir, w.seq+1)
+	}
+	if err != nil {
+		w.f = nil
+		w.err = err
+		return 0, err
+	}
+	w.f = f
+	w.seq++
+	return w.seq, nil
+}
+
+func (w *wal[K, V]) every(d time.Duration, fn func()) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// loadSnapshot 加载快照文件，返回需要从哪个 WAL 段开始重放。
+func (m *ConcurrentMap[K, V]) loadSnapshot(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var begin walRecord[K, V]
+	if _, err := readFrame(r, &begin); err != nil || begin.Op != opSnapshotBegin {
+		return 0, fmt.Errorf("%w: %s 缺少开始标记", ErrCorrupt, path)
+	}
+
+	now := m.nowNano()
+	n := 0
+	for {
+		var rec walRecord[K, V]
+		if _, err := readFrame(r, &rec); err != nil {
+			return 0, fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+		}
+		if rec.Op == opSnapshotEnd {
+			if rec.Count != n {
+				return 0, fmt.Errorf("%w: %s 条目数 %d, 期望 %d", ErrCorrupt, path, n, rec.Count)
+			}
+			return begin.Seg, nil
+		}
+		m.apply(rec, now)
+		n++
+	}
+}
+
+// replaySegment 重放一个 WAL 段，返回最后一条完整记录之后的偏移。
+func (m *ConcurrentMap[K, V]) replaySegment(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	now := m.nowNano()
+	var off int64
+	for {
+		var rec walRecord[K, V]
+		n, err := readFrame(r, &rec)
+		if err == io.EOF {
+			return off, nil
+		}
+		if err != nil {
+			return off, err
+		}
+		m.apply(rec, now)
+		off += int64(n)
+	}
+}
+
+// apply 把一条记录应用到 map：恢复时 WAL 尚未打开，不会重复记录；副本也用它应用主节点推送的记录。
+// batch 记录锁住涉及的所有分片后整体应用，副本上的读者看不到只应用了一半的事务。
+func (m *ConcurrentMap[K, V]) apply(rec walRecord[K, V], now int64) {
+	if rec.Op != opBatch {
+		s := m.shardFor(rec.Key)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.applyLocked(rec, now)
+		return
+	}
+
+	keys := make([]K, len(rec.Batch))
+	for i, r := range rec.Batch {
+		keys[i] = r.Key
+	}
+	order := m.lockShards(keys)
+	defer m.unlockShards(order)
+	for _, r := range rec.Batch {
+		m.shardFor(r.Key).applyLocked(r, now)
+	}
+}
+
+func (s *shard[K, V]) applyLocked(rec walRecord[K, V], now int64) {
+	if rec.Op == opPut && (rec.ExpireAt == 0 || now < rec.ExpireAt) {
+		s.set(rec.Key, rec.Value, rec.ExpireAt)
+		return
+	}
+	s.del(rec.Key)
+}
+
+func writeSnapshot[K comparable, V any](dir string, snap *Snapshot[K, V], seg uint64) error {
+	tmp := filepath.Join(dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	bw := bufio.NewWriter(f)
+	write := func(rec walRecord[K, V]) error {
+		frame, err := encodeFrame(rec)
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(frame)
+		return err
+	}
+
+	err = write(walRecord[K, V]{Op: opSnapshotBegin, Seg: seg})
+	n := 0
+	for _, data := range snap.shards {
+		for k, e := range data {
+			if err != nil {
+				break
+			}
+			if e.expired(snap.now) {
+				continue
+			}
+			err = write(walRecord[K, V]{Op: opPut, Key: k, Value: e.value, ExpireAt: e.expireAt})
+			n++
+		}
+	}
+	if err == nil {
+		err = write(walRecord[K, V]{Op: opSnapshotEnd, Count: n})
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(dir, snapshotFile)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// encodeRecord 编码一条要写入 WAL 和复制流的记录，负载超过 maxFrameSize-frameHeadroom 时返回 ErrTooLarge。
+func encodeRecord[K comparable, V any](rec walRecord[K, V]) ([]byte, error) {
+	return encodeFrameLimit(rec, maxFrameSize-frameHeadroom)
+}
+
+func encodeFrame(rec any) ([]byte, error) {
+	return encodeFrameLimit(rec, maxFrameSize)
+}
+
+func encodeFrameLimit(rec any, limit int) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > limit {
+		return nil, fmt.Errorf("%w: %d 字节, 上限 %d", ErrTooLarge, len(payload), limit)
+	}
+	frame := make([]byte, 8+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[8:], payload)
+	return frame, nil
+}
+
+// readFrame 读取一帧并解码到 v，返回帧的字节数。干净地读到结尾返回 io.EOF，
+// 帧不完整、长度异常或校验失败返回 errTornTail。
+func readFrame(r *bufio.Reader, v any) (int, error) {
+	var hdr [8]byte
+	n, err := io.ReadFull(r, hdr[:])
+	if err == io.EOF {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return n, errTornTail
+	}
+
+	size := binary.LittleEndian.Uint32(hdr[0:4])
+	if int(size) > maxFrameSize {
+		return n, errTornTail
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return n, errTornTail
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(hdr[4:8]) {
+		return n, errTornTail
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return n, errTornTail
+	}
+	return 8 + int(size), nil
+}
+
+func segmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%016d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+func openSegment(dir string, seq uint64) (*os.File, error) {
+	f, err := os.OpenFile(segmentPath(dir, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		var seq uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), "%d", &seq); err != nil {
+			continue
+		}
+		segs = append(segs, seq)
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+	return segs, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,322 @@
+package cmap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustOpen(t *testing.T, dir string, opts ...Option) *ConcurrentMap[string, int] {
+	t.Helper()
+	m, err := Open[string, int](dir, opts...)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return m
+}
+
+func mustClose(t *testing.T, m *ConcurrentMap[string, int]) {
+	t.Helper()
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func expectValue(t *testing.T, m *ConcurrentMap[string, int], k string, want int) {
+	t.Helper()
+	if v, ok := m.Get(k); !ok || v != want {
+		t.Fatalf("Get(%q) = %v, %v, want %d", k, v, ok, want)
+	}
+}
+
+func lastSegment(t *testing.T, dir string) string {
+	t.Helper()
+	segs, err := listSegments(dir)
+	if err != nil || len(segs) == 0 {
+		t.Fatalf("listSegments = %v, %v", segs, err)
+	}
+	return segmentPath(dir, segs[len(segs)-1])
+}
+
+func TestWALRecover(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+
+	m := mustOpen(t, dir, WithClock(clock.Now), WithFsync(FsyncAlways))
+	m.Put("a", 1)
+	m.Put("b", 2)
+	m.Put("a", 3)
+	m.Delete("b")
+	m.PutWithTTL("session", 4, time.Minute)
+	m.PutWithTTL("short", 5, time.Second)
+	m.Compute("counter", func(old int, ok bool) (int, bool) { return old + 10, true })
+	mustClose(t, m)
+
+	clock.Advance(2 * time.Second)
+	m = mustOpen(t, dir, WithClock(clock.Now))
+	defer mustClose(t, m)
+
+	expectValue(t, m, "a", 3)
+	expectValue(t, m, "session", 4)
+	expectValue(t, m, "counter", 10)
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("删除的键不应该被恢复")
+	}
+	if _, ok := m.Get("short"); ok {
+		t.Fatal("已过期的键不应该被恢复")
+	}
+
+	// TTL 按绝对时间恢复
+	clock.Advance(time.Minute)
+	if _, ok := m.Get("session"); ok {
+		t.Fatal("session 应该按原来的过期时间过期")
+	}
+}
+
+func TestWALCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir)
+	for i := 0; i < 100; i++ {
+		m.Put("k", i)
+	}
+	m.Put("gone", 1)
+	m.Delete("gone")
+	if err := m.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	m.Put("after", 1)
+	mustClose(t, m)
+
+	segs, _ := listSegments(dir)
+	if len(segs) != 1 {
+		t.Fatalf("压缩后应只剩一个段, got %v", segs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	m = mustOpen(t, dir)
+	defer mustClose(t, m)
+	expectValue(t, m, "k", 99)
+	expectValue(t, m, "after", 1)
+	if n := m.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+}
+
+func TestWALCompactInterval(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir, WithCompactInterval(time.Millisecond))
+	m.Put("a", 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("后台压缩没有写出快照")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mustClose(t, m)
+
+	m = mustOpen(t, dir)
+	defer mustClose(t, m)
+	expectValue(t, m, "a", 1)
+}
+
+func TestWALTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir)
+	m.Put("a", 1)
+	m.Put("b", 2)
+	mustClose(t, m)
+
+	// 模拟写到一半崩溃：尾部多出半帧
+	path := lastSegment(t, dir)
+	info, _ := os.Stat(path)
+	good := info.Size()
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.Write([]byte{0x20, 0, 0, 0, 1, 2})
+	f.Close()
+
+	m = mustOpen(t, dir)
+	expectValue(t, m, "a", 1)
+	expectValue(t, m, "b", 2)
+	if info, _ := os.Stat(path); info.Size() != good {
+		t.Fatalf("尾部应该被截断到 %d, got %d", good, info.Size())
+	}
+
+	// 截断后继续追加，再次恢复仍然完整
+	m.Put("c", 3)
+	mustClose(t, m)
+	m = mustOpen(t, dir)
+	defer mustClose(t, m)
+	expectValue(t, m, "c", 3)
+}
+
+func TestWALCorruptedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir)
+	m.Put("a", 1)
+	m.Put("b", 2)
+	mustClose(t, m)
+
+	// 翻转最后一条记录的最后一个字节，CRC 校验失败
+	path := lastSegment(t, dir)
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+
+	m = mustOpen(t, dir)
+	defer mustClose(t, m)
+	expectValue(t, m, "a", 1)
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("校验失败的记录不应该被应用")
+	}
+}
+
+func TestWALTxnAtomic(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir)
+	m.Put("a", 100)
+	m.Put("b", 0)
+	transfer := func() {
+		t.Helper()
+		tx := m.Txn()
+		a, _ := tx.Get("a")
+		b, _ := tx.Get("b")
+		tx.Put("a", a-10)
+		tx.Put("b", b+10)
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+	}
+	transfer()
+	mustClose(t, m)
+
+	m = mustOpen(t, dir)
+	expectValue(t, m, "a", 90)
+	expectValue(t, m, "b", 10)
+	transfer()
+	mustClose(t, m)
+
+	// 第二个事务写到一半崩溃：整个事务被丢弃，不会只留下其中一个键的写入
+	path := lastSegment(t, dir)
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-3)
+
+	m = mustOpen(t, dir)
+	defer mustClose(t, m)
+	expectValue(t, m, "a", 90)
+	expectValue(t, m, "b", 10)
+}
+
+// 超过单帧上限的写入在生效之前被拒绝，不会写出一条恢复时被当作损坏尾部的帧，连带截掉之后的写入
+func TestWALRejectsOversizedRecord(t *testing.T) {
+	defer func(n int) { maxFrameSize = n }(maxFrameSize)
+	maxFrameSize = 4 << 10
+	big := strings.Repeat("x", maxFrameSize)
+
+	dir := t.TempDir()
+	m, err := Open[string, string](dir, WithFsync(FsyncAlways))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Put("a", "1")
+	m.Put("big", big)
+	m.Put("b", "2")
+	if _, ok := m.Get("big"); ok {
+		t.Fatal("超过上限的写入不应该生效")
+	}
+	if err := m.Sync(); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Sync = %v, want ErrTooLarge", err)
+	}
+
+	tx := m.Txn()
+	tx.Put("c", big[:maxFrameSize/2])
+	tx.Put("d", big[:maxFrameSize/2])
+	if err := tx.Commit(); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Commit = %v, want ErrTooLarge", err)
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Fatal("超过上限的事务不应该写入任何键")
+	}
+	m.Put("e", "3")
+	if err := m.Close(); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Close = %v, want ErrTooLarge", err)
+	}
+
+	m, err = Open[string, string](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for k, want := range map[string]string{"a": "1", "b": "2", "e": "3"} {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Fatalf("恢复后 Get(%q) = %q, %v, want %q", k, v, ok, want)
+		}
+	}
+	for _, k := range []string{"big", "c", "d"} {
+		if _, ok := m.Get(k); ok {
+			t.Fatalf("恢复后不应该有 %q", k)
+		}
+	}
+}
+
+func TestWALCorruptedMiddleSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir)
+	m.Put("a", 1)
+	first := lastSegment(t, dir)
+	m.wal.rotate()
+	m.Put("b", 2)
+	mustClose(t, m)
+
+	data, _ := os.ReadFile(first)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(first, data, 0o644)
+
+	if _, err := Open[string, int](dir); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestWALCorruptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	m := mustOpen(t, dir)
+	m.Put("a", 1)
+	m.Put("b", 2)
+	if err := m.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	mustClose(t, m)
+
+	path := filepath.Join(dir, snapshotFile)
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-3], 0o644)
+
+	if _, err := Open[string, int](dir); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestWALNotPersistent(t *testing.T) {
+	m := New[string, int]()
+	if err := m.Compact(); !errors.Is(err, ErrNotPersistent) {
+		t.Fatalf("err = %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("没有持久化时 Close 应该是空操作, err = %v", err)
+	}
+}
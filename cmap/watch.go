@@ -0,0 +1,232 @@
+package cmap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType 是变更事件的类型。
+type EventType int
+
+const (
+	EventPut    EventType = iota + 1 // 写入或覆盖
+	EventDelete                      // 删除、过期或被容量淘汰
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "PUT"
+	case EventDelete:
+		return "DELETE"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event 描述一次键的变更，Old/HadOld 是变更前的值，New 只在 EventPut 时有意义。
+type Event[K comparable, V any] struct {
+	Type   EventType
+	Key    K
+	Old    V
+	HadOld bool
+	New    V
+	Rev    uint64
+}
+
+// SlowPolicy 决定订阅者的缓冲区满时如何处理新事件。
+type SlowPolicy int
+
+const (
+	// SlowDisconnect 关闭订阅者的通道，订阅者据此得知自己丢了事件，需要重新同步。
+	SlowDisconnect SlowPolicy = iota
+	// SlowDrop 丢弃新事件，订阅者继续收后续事件。
+	SlowDrop
+	// SlowBlock 阻塞写入者直到订阅者腾出空间，写入者所在的分片在此期间无法写入；
+	// 其他分片的写入只有在同样要投递给这个订阅者时才会被阻塞，其他订阅的增删不受影响。
+	// 订阅者在接收循环里不能写同一个 map，否则可能互相等待。
+	SlowBlock
+)
+
+const defaultWatchBuffer = 64
+
+// WatchOption 配置一个订阅。
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	buffer int
+	policy SlowPolicy
+}
+
+// WithWatchBuffer 设置订阅通道的缓冲区大小，默认 64。
+func WithWatchBuffer(n int) WatchOption {
+	return func(o *watchOptions) {
+		o.buffer = n
+	}
+}
+
+// WithSlowPolicy 设置慢消费者策略，默认 SlowDisconnect。
+func WithSlowPolicy(p SlowPolicy) WatchOption {
+	return func(o *watchOptions) {
+		o.policy = p
+	}
+}
+
+// Watch 订阅键 k 的变更，ctx 结束或因慢消费被断开时关闭返回的通道。
+// 事件在写入者持有分片锁时投递，同一个键的事件顺序与写入顺序一致。
+func (m *ConcurrentMap[K, V]) Watch(ctx context.Context, k K, opts ...WatchOption) <-chan Event[K, V] {
+	return m.watch(ctx, func(key K) bool { return key == k }, opts)
+}
+
+// WatchPrefix 订阅所有以 prefix 开头的键的变更。非 string 键按 fmt.Sprint 的结果匹配。
+func (m *ConcurrentMap[K, V]) WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) <-chan Event[K, V] {
+	return m.watch(ctx, func(key K) bool { return strings.HasPrefix(keyString(key), prefix) }, opts)
+}
+
+func (m *ConcurrentMap[K, V]) watch(ctx context.Context, match func(K) bool, opts []WatchOption) <-chan Event[K, V] {
+	o := watchOptions{buffer: defaultWatchBuffer, policy: SlowDisconnect}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &watcher[K, V]{
+		match:  match,
+		policy: o.policy,
+		ch:     make(chan Event[K, V], o.buffer),
+		done:   make(chan struct{}),
+	}
+	m.watchers.add(w)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.stop()
+		case <-w.done:
+		}
+		m.watchers.remove(w)
+		w.close()
+	}()
+	return w.ch
+}
+
+func keyString[K comparable](k K) string {
+	if s, ok := any(k).(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
+
+// watchHub 管理所有订阅者。订阅者列表写时复制：增删时在 mu 下换一份新列表，
+// 投递时无锁读取当前列表，所以阻塞在某个订阅者上的投递不会挡住其他订阅的增删，
+// 也不会通过等待中的增删挡住其他分片的投递。
+type watchHub[K comparable, V any] struct {
+	mu   sync.Mutex
+	list atomic.Pointer[[]*watcher[K, V]]
+}
+
+func (h *watchHub[K, V]) active() bool {
+	l := h.list.Load()
+	return l != nil && len(*l) > 0
+}
+
+func (h *watchHub[K, V]) add(w *watcher[K, V]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var next []*watcher[K, V]
+	if l := h.list.Load(); l != nil {
+		next = append(next, *l...)
+	}
+	next = append(next, w)
+	h.list.Store(&next)
+}
+
+func (h *watchHub[K, V]) remove(w *watcher[K, V]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l := h.list.Load()
+	if l == nil {
+		return
+	}
+	next := make([]*watcher[K, V], 0, len(*l))
+	for _, x := range *l {
+		if x != w {
+			next = append(next, x)
+		}
+	}
+	h.list.Store(&next)
+}
+
+// publish 由写入者在持有分片锁时调用。
+func (h *watchHub[K, V]) publish(ev Event[K, V]) {
+	l := h.list.Load()
+	if l == nil {
+		return
+	}
+	for _, w := range *l {
+		if w.match(ev.Key) {
+			w.send(ev)
+		}
+	}
+}
+
+type watcher[K comparable, V any] struct {
+	match  func(K) bool
+	policy SlowPolicy
+	ch     chan Event[K, V]
+	done   chan struct{}
+	once   sync.Once
+
+	// 投递者持有读锁，close 持有写锁，保证不会向已关闭的通道发送。
+	// close 之前 done 已经关闭，阻塞中的投递会立即返回并释放读锁
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (w *watcher[K, V]) stop() {
+	w.once.Do(func() { close(w.done) })
+}
+
+func (w *watcher[K, V]) close() {
+	w.stop()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	close(w.ch)
+}
+
+func (w *watcher[K, V]) send(ev Event[K, V]) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	switch w.policy {
+	case SlowBlock:
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+		}
+	case SlowDrop:
+		select {
+		case w.ch <- ev:
+		default:
+		}
+	default:
+		select {
+		case w.ch <- ev:
+		default:
+			w.stop()
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package cmap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func recvEvent[K comparable, V any](t *testing.T, ch <-chan Event[K, V]) Event[K, V] {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("订阅通道被意外关闭")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待事件超时")
+	}
+	panic("unreachable")
+}
+
+func TestWatchKey(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.Watch(ctx, "k")
+	m.Put("other", 0)
+	m.Put("k", 1)
+	m.Put("k", 2)
+	m.Delete("k")
+
+	ev := recvEvent(t, ch)
+	if ev.Type != EventPut || ev.Key != "k" || ev.HadOld || ev.New != 1 {
+		t.Fatalf("第一个事件 = %+v", ev)
+	}
+	ev = recvEvent(t, ch)
+	if ev.Type != EventPut || !ev.HadOld || ev.Old != 1 || ev.New != 2 {
+		t.Fatalf("第二个事件 = %+v", ev)
+	}
+	ev = recvEvent(t, ch)
+	if ev.Type != EventDelete || ev.Old != 2 {
+		t.Fatalf("第三个事件 = %+v", ev)
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.WatchPrefix(ctx, "user/")
+	m.Put("order/1", 1)
+	m.Put("user/1", 1)
+	m.Put("user/2", 2)
+
+	if ev := recvEvent(t, ch); ev.Key != "user/1" {
+		t.Fatalf("事件 = %+v", ev)
+	}
+	if ev := recvEvent(t, ch); ev.Key != "user/2" {
+		t.Fatalf("事件 = %+v", ev)
+	}
+}
+
+func TestWatchRevisionsIncrease(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.Watch(ctx, "k")
+	for i := 0; i < 10; i++ {
+		m.Put("k", i)
+	}
+	var last uint64
+	for i := 0; i < 10; i++ {
+		ev := recvEvent(t, ch)
+		if ev.New != i || ev.Rev <= last {
+			t.Fatalf("事件乱序: %+v, 上一个版本 %d", ev, last)
+		}
+		last = ev.Rev
+	}
+}
+
+func TestWatchCancelClosesChannel(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch := m.Watch(ctx, "k")
+	cancel()
+	for range ch {
+	}
+	if m.watchers.active() {
+		t.Fatal("取消后订阅者应该被摘除")
+	}
+	m.Put("k", 1) // 没有订阅者时写入不受影响
+}
+
+func TestWatchSlowDrop(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.Watch(ctx, "k", WithWatchBuffer(1), WithSlowPolicy(SlowDrop))
+	m.Put("k", 1)
+	m.Put("k", 2) // 缓冲区满，被丢弃
+	if ev := recvEvent(t, ch); ev.New != 1 {
+		t.Fatalf("事件 = %+v", ev)
+	}
+	m.Put("k", 3)
+	if ev := recvEvent(t, ch); ev.New != 3 {
+		t.Fatalf("丢弃后应该继续收到新事件, got %+v", ev)
+	}
+}
+
+func TestWatchSlowDisconnect(t *testing.T) {
+	m := New[string, int]()
+	ch := m.Watch(context.Background(), "k", WithWatchBuffer(1))
+
+	m.Put("k", 1)
+	m.Put("k", 2) // 缓冲区满，断开
+
+	if ev := recvEvent(t, ch); ev.New != 1 {
+		t.Fatalf("事件 = %+v", ev)
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("慢消费者应该被断开")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("通道没有被关闭")
+	}
+}
+
+func TestWatchSlowBlock(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.Watch(ctx, "k", WithWatchBuffer(0), WithSlowPolicy(SlowBlock))
+	go func() {
+		for i := 0; i < 100; i++ {
+			m.Put("k", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if ev := recvEvent(t, ch); ev.New != i {
+			t.Fatalf("阻塞策略不应该丢事件, got %+v want %d", ev, i)
+		}
+	}
+}
+
+// 一个阻塞的 SlowBlock 订阅者只挡住投递给它的写入：同时增删其他订阅、写入其他分片的键都不受影响
+func TestWatchSlowBlockDoesNotFreezeMap(t *testing.T) {
+	m := New[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m.Watch(ctx, "k", WithWatchBuffer(0), WithSlowPolicy(SlowBlock))
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		m.Put("k", 1) // 没有人接收，阻塞到 cancel
+	}()
+	select {
+	case <-blocked:
+		t.Fatal("没有人接收时 SlowBlock 的写入应该阻塞")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	other := "other"
+	for i := 0; m.shardIndex(other) == m.shardIndex("k"); i++ {
+		other = fmt.Sprint("other", i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wctx, wcancel := context.WithCancel(context.Background())
+		ch := m.Watch(wctx, other)
+		wcancel()
+		for range ch {
+		}
+		m.Watch(ctx, other)
+		m.Put(other, 2)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("阻塞的订阅者挡住了其他订阅的增删和其他分片的写入")
+	}
+
+	cancel()
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消订阅后阻塞的写入应该返回")
+	}
+}
+
+// 删除已经过期的条目时 Delete 返回 false，事件也不应该带着过期的旧值
+func TestWatchDeleteExpired(t *testing.T) {
+	clock := newFakeClock()
+	m := New[string, int](WithClock(clock.Now))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.Watch(ctx, "k")
+	m.PutWithTTL("k", 1, time.Second)
+	recvEvent(t, ch)
+	clock.Advance(time.Second)
+	if m.Delete("k") {
+		t.Fatal("删除过期条目应该返回 false")
+	}
+	ev := recvEvent(t, ch)
+	if ev.Type != EventDelete || ev.HadOld || ev.Old != 0 {
+		t.Fatalf("事件 = %+v, want 没有旧值的 DELETE", ev)
+	}
+
+	m.Put("k", 2)
+	recvEvent(t, ch)
+	m.Delete("k")
+	if ev := recvEvent(t, ch); !ev.HadOld || ev.Old != 2 {
+		t.Fatalf("事件 = %+v, want 旧值 2", ev)
+	}
+}
+
+func TestWatchExpiryAndEviction(t *testing.T) {
+	clock := newFakeClock()
+	m := NewBounded[string, int](1, NewLRU[string], WithClock(clock.Now))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := m.WatchPrefix(ctx, "")
+	m.PutWithTTL("a", 1, time.Second)
+	clock.Advance(time.Second)
+	m.DeleteExpired()
+	m.Put("b", 2)
+	m.Put("c", 3) // 淘汰 b
+
+	want := []struct {
+		typ EventType
+		key string
+	}{
+		{EventPut, "a"}, {EventDelete, "a"}, {EventPut, "b"}, {EventPut, "c"}, {EventDelete, "b"},
+	}
+	for _, w := range want {
+		ev := recvEvent(t, ch)
+		if ev.Type != w.typ || ev.Key != w.key {
+			t.Fatalf("事件 = %v %s, want %v %s", ev.Type, ev.Key, w.typ, w.key)
+		}
+	}
+}
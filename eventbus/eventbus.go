@@ -0,0 +1,368 @@
+// Package eventbus 提供按 topic 划分的泛型事件总线，取代 TestCond 里
+// 用 sync.Cond 手写 subscribe 的做法：订阅可以取消，事件可以携带数据，
+// 订阅者可以选择同步或异步接收，一个订阅者 panic 不会影响发布者和其他订阅者。
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+)
+
+// ErrClosed 表示总线已经关闭。
+var ErrClosed = errors.New("eventbus: 总线已关闭")
+
+// Event 是投递给订阅者的事件。Seq 在每个 topic 内从 1 开始严格递增。
+type Event[T any] struct {
+	Topic string
+	Seq   uint64
+	Data  T
+}
+
+// Option 配置 EventBus。
+type Option func(*options)
+
+type options struct {
+	onPanic func(topic string, recovered any)
+	history int
+}
+
+// WithPanicHandler 设置订阅者回调 panic 时的处理函数，默认用 log 打印。
+// panic 的订阅者不会被取消，之后的事件照常投递给它。
+func WithPanicHandler(fn func(topic string, recovered any)) Option {
+	return func(o *options) {
+		o.onPanic = fn
+	}
+}
+
+// WithHistory 让每个 topic 保留最近 n 个事件，晚到的订阅者可以用 Last 或 Since 先回放历史再接收新事件。
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.history = n
+	}
+}
+
+// SubscribeOption 配置单个订阅。
+type SubscribeOption func(*subOptions)
+
+type subOptions struct {
+	async  bool
+	buffer int
+
+	replay  bool
+	last    int
+	since   uint64
+	useLast bool
+}
+
+// Async 让订阅者在自己的 goroutine 中异步处理事件，最多缓冲 buffer 个未处理的事件。
+// 缓冲区满时 Publish 等待，直到有空位或 Publish 的 ctx 结束。
+// 默认是同步订阅：回调在 Publish 的 goroutine 中执行，Publish 等所有同步回调返回后才返回。
+func Async(buffer int) SubscribeOption {
+	return func(o *subOptions) {
+		o.async = true
+		o.buffer = buffer
+	}
+}
+
+// Last 让订阅者先收到历史中最近的 n 个事件，再接收新事件。需要总线开启 WithHistory。
+func Last(n int) SubscribeOption {
+	return func(o *subOptions) {
+		o.replay, o.useLast, o.last = true, true, n
+	}
+}
+
+// Since 让订阅者先收到历史中 Seq >= seq 的事件，再接收新事件。需要总线开启 WithHistory。
+// 已经被挤出历史的事件无法回放，订阅者可以通过收到的第一个 Seq 发现缺口。
+func Since(seq uint64) SubscribeOption {
+	return func(o *subOptions) {
+		o.replay, o.useLast, o.since = true, false, seq
+	}
+}
+
+// EventBus 管理一组 topic。零值不可用，请使用 New 创建。
+type EventBus[T any] struct {
+	onPanic func(topic string, recovered any)
+	history int
+
+	mu     sync.Mutex
+	topics map[string]*Topic[T]
+	closed bool
+
+	wg sync.WaitGroup // 异步订阅者的 goroutine
+}
+
+// New 创建一个事件总线。
+func New[T any](opts ...Option) *EventBus[T] {
+	o := options{onPanic: func(topic string, recovered any) {
+		log.Printf("eventbus: topic %q 的订阅者 panic: %v", topic, recovered)
+	}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &EventBus[T]{
+		onPanic: o.onPanic,
+		history: max(o.history, 0),
+		topics:  make(map[string]*Topic[T]),
+	}
+}
+
+// Topic 返回名为 name 的 topic，不存在时创建。
+func (b *EventBus[T]) Topic(name string) *Topic[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		t = &Topic[T]{bus: b, name: name, closed: b.closed}
+		if b.history > 0 {
+			t.history = make([]Event[T], 0, b.history)
+		}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Close 取消所有订阅并等待异步订阅者正在执行的回调返回，之后 Publish 返回 ErrClosed。
+// 不要在订阅者的回调中调用 Close。
+func (b *EventBus[T]) Close() {
+	b.mu.Lock()
+	b.closed = true
+	topics := make([]*Topic[T], 0, len(b.topics))
+	for _, t := range b.topics {
+		topics = append(topics, t)
+	}
+	b.mu.Unlock()
+
+	for _, t := range topics {
+		t.mu.Lock()
+		t.closed = true
+		subs := t.subs
+		t.subs = nil
+		t.mu.Unlock()
+		for _, s := range subs {
+			s.stop()
+		}
+	}
+	b.wg.Wait()
+}
+
+// Topic 是一个事件流。同一个 topic 上的发布是串行的，所以每个订阅者都按 Seq 顺序收到事件，
+// 不会重复也不会乱序。
+//
+// 同步订阅者的回调中不能向同一个 topic 发布，否则会死锁；需要时改用异步订阅。
+// 回调中可以自由地订阅和取消订阅。
+type Topic[T any] struct {
+	bus  *EventBus[T]
+	name string
+
+	pubMu sync.Mutex // 串行化发布
+
+	mu     sync.Mutex
+	seq    uint64
+	subs   []*Subscription[T] // 按订阅顺序
+	closed bool
+
+	// history 是最近事件的环形缓冲区，写满后 head 指向最旧的事件
+	history []Event[T]
+	head    int
+}
+
+// Name 返回 topic 的名字。
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Subscribe 注册一个订阅者，默认只会收到订阅之后发布的事件。
+// 用 Last 或 Since 请求历史时，订阅者先按顺序收到历史事件，紧接着是订阅之后的新事件，
+// 两者之间没有缺口也没有重复。同步订阅者的历史在 Subscribe 返回前回放完。
+func (t *Topic[T]) Subscribe(fn func(Event[T]), opts ...SubscribeOption) *Subscription[T] {
+	var o subOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &Subscription[T]{topic: t, fn: fn, done: make(chan struct{})}
+	if o.async {
+		s.queue = make(chan Event[T], max(o.buffer, 0))
+	}
+
+	// 同步订阅者在加入列表前先锁住自己，新事件的投递会等历史回放完
+	if s.queue == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		close(s.done)
+		return s
+	}
+	var replay []Event[T]
+	if o.replay {
+		replay = t.replay(o)
+	}
+	t.subs = append(t.subs, s)
+	if s.queue != nil {
+		t.bus.wg.Add(1)
+		go s.run(replay)
+	}
+	t.mu.Unlock()
+
+	if s.queue == nil {
+		for _, ev := range replay {
+			if s.stopped() {
+				break
+			}
+			s.call(ev)
+		}
+	}
+	return s
+}
+
+// replay 按请求从历史中取出要回放的事件，调用方需持有 t.mu。
+func (t *Topic[T]) replay(o subOptions) []Event[T] {
+	events := make([]Event[T], 0, len(t.history))
+	events = append(events, t.history[t.head:]...)
+	events = append(events, t.history[:t.head]...)
+	if o.useLast {
+		return events[len(events)-min(max(o.last, 0), len(events)):]
+	}
+	for i, ev := range events {
+		if ev.Seq >= o.since {
+			return events[i:]
+		}
+	}
+	return nil
+}
+
+// Publish 把 evt 投递给当前所有订阅者。同步订阅者的回调全部返回后 Publish 才返回；
+// 异步订阅者只要放进它的缓冲区即可。
+// 等待异步订阅者的缓冲区时 ctx 结束，Publish 仍会投递给其他能立即接收的订阅者，然后返回 ctx.Err()，
+// 没有接收到的订阅者会错过这个事件。
+func (t *Topic[T]) Publish(ctx context.Context, evt T) error {
+	t.pubMu.Lock()
+	defer t.pubMu.Unlock()
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrClosed
+	}
+	t.seq++
+	ev := Event[T]{Topic: t.name, Seq: t.seq, Data: evt}
+	if cap(t.history) > 0 {
+		if len(t.history) < cap(t.history) {
+			t.history = append(t.history, ev)
+		} else {
+			t.history[t.head] = ev
+			t.head = (t.head + 1) % len(t.history)
+		}
+	}
+	subs := slices.Clone(t.subs)
+	t.mu.Unlock()
+
+	var err error
+	for _, s := range subs {
+		if e := s.deliver(ctx, ev); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Subscription 是一个订阅，用 Unsubscribe 取消。
+type Subscription[T any] struct {
+	topic *Topic[T]
+	fn    func(Event[T])
+
+	mu    sync.Mutex    // 同步订阅者回调和回放历史期间持有，保证回调不并发执行
+	queue chan Event[T] // 只有异步订阅者才有
+	done  chan struct{} // 取消订阅时关闭
+	once  sync.Once
+}
+
+// Unsubscribe 取消订阅，之后不会再开始执行新的回调，异步订阅者缓冲区中未处理的事件被丢弃。
+// 可以在回调中调用，重复调用是安全的。
+func (s *Subscription[T]) Unsubscribe() {
+	t := s.topic
+	t.mu.Lock()
+	if i := slices.Index(t.subs, s); i >= 0 {
+		t.subs = slices.Delete(t.subs, i, i+1)
+	}
+	t.mu.Unlock()
+	s.stop()
+}
+
+func (s *Subscription[T]) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *Subscription[T]) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Subscription[T]) deliver(ctx context.Context, ev Event[T]) error {
+	if s.queue == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.stopped() {
+			s.call(ev)
+		}
+		return nil
+	}
+
+	// 先尝试不阻塞地放入，ctx 已经结束时也能投递给还有空位的订阅者
+	select {
+	case s.queue <- ev:
+		return nil
+	case <-s.done:
+		return nil
+	default:
+	}
+	select {
+	case s.queue <- ev:
+		return nil
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Subscription[T]) run(replay []Event[T]) {
+	defer s.topic.bus.wg.Done()
+	for _, ev := range replay {
+		if s.stopped() {
+			return
+		}
+		s.call(ev)
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case ev := <-s.queue:
+			if s.stopped() {
+				return
+			}
+			s.call(ev)
+		}
+	}
+}
+
+// call 执行回调，回调 panic 时交给总线的 panic 处理函数，不影响调用方。
+func (s *Subscription[T]) call(ev Event[T]) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.topic.bus.onPanic(s.topic.name, r)
+		}
+	}()
+	s.fn(ev)
+}
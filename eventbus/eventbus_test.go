@@ -0,0 +1,234 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 用事件总线重写 TestCond 的按钮例子：三个订阅者都收到点击事件，并且可以取消订阅
+func TestButtonClicked(t *testing.T) {
+	bus := New[string]()
+	defer bus.Close()
+	clicked := bus.Topic("button.clicked")
+
+	var got sync.WaitGroup
+	var subs []*Subscription[string]
+	for _, v := range []string{
+		"Maximizing window.",
+		"Displaying annoying dialog box!",
+		"Mouse clicked."} {
+		got.Add(1)
+		subs = append(subs, clicked.Subscribe(func(ev Event[string]) {
+			t.Log(v, "button:", ev.Data)
+			got.Done()
+		}, Async(1)))
+	}
+
+	if err := clicked.Publish(context.Background(), "left"); err != nil {
+		t.Fatal(err)
+	}
+	got.Wait()
+
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+	if err := clicked.Publish(context.Background(), "right"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncDelivery(t *testing.T) {
+	bus := New[int]()
+	defer bus.Close()
+	topic := bus.Topic("t")
+
+	var got []int
+	topic.Subscribe(func(ev Event[int]) { got = append(got, ev.Data) })
+	for i := 0; i < 10; i++ {
+		topic.Publish(context.Background(), i)
+	}
+	// 同步订阅在 Publish 返回前已经执行完
+	if len(got) != 10 {
+		t.Fatalf("got %v", got)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("got %v, 应该按发布顺序", got)
+		}
+	}
+}
+
+func TestTopicsAreIndependent(t *testing.T) {
+	bus := New[string]()
+	defer bus.Close()
+
+	var a, b atomic.Int32
+	bus.Topic("a").Subscribe(func(Event[string]) { a.Add(1) })
+	bus.Topic("b").Subscribe(func(Event[string]) { b.Add(1) })
+	bus.Topic("a").Publish(context.Background(), "x")
+
+	if a.Load() != 1 || b.Load() != 0 {
+		t.Fatalf("a = %d, b = %d", a.Load(), b.Load())
+	}
+	if bus.Topic("a") != bus.Topic("a") {
+		t.Fatal("同名 topic 应该是同一个")
+	}
+}
+
+// 多个发布者并发发布时，每个订阅者看到的 Seq 严格递增且没有缺口
+func TestOrderedPerSubscriber(t *testing.T) {
+	bus := New[int]()
+	defer bus.Close()
+	topic := bus.Topic("t")
+
+	const publishers, each = 8, 200
+	type result struct {
+		mu   sync.Mutex
+		seqs []uint64
+	}
+	var results []*result
+	var received sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		r := &result{}
+		results = append(results, r)
+		var opts []SubscribeOption
+		if i%2 == 1 {
+			opts = append(opts, Async(16))
+		}
+		received.Add(publishers * each)
+		topic.Subscribe(func(ev Event[int]) {
+			r.mu.Lock()
+			r.seqs = append(r.seqs, ev.Seq)
+			r.mu.Unlock()
+			received.Done()
+		}, opts...)
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				topic.Publish(context.Background(), i)
+			}
+		}()
+	}
+	wg.Wait()
+	received.Wait()
+
+	for i, r := range results {
+		for j, seq := range r.seqs {
+			if seq != uint64(j+1) {
+				t.Fatalf("订阅者 %d 第 %d 个事件的 Seq = %d", i, j, seq)
+			}
+		}
+	}
+}
+
+func TestPanicIsolation(t *testing.T) {
+	var panics atomic.Int32
+	bus := New[int](WithPanicHandler(func(topic string, r any) { panics.Add(1) }))
+	defer bus.Close()
+	topic := bus.Topic("t")
+
+	var syncGot, asyncGot atomic.Int32
+	done := make(chan struct{})
+	topic.Subscribe(func(ev Event[int]) { panic("sync boom") })
+	topic.Subscribe(func(ev Event[int]) { panic("async boom") }, Async(4))
+	topic.Subscribe(func(ev Event[int]) { syncGot.Add(1) })
+	topic.Subscribe(func(ev Event[int]) {
+		if asyncGot.Add(1) == 2 {
+			close(done)
+		}
+	}, Async(4))
+
+	for i := 0; i < 2; i++ {
+		if err := topic.Publish(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if syncGot.Load() != 2 {
+		t.Fatalf("同步订阅者收到 %d 个事件", syncGot.Load())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for panics.Load() != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("panic 处理了 %d 次, want 4", panics.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUnsubscribeInsideHandler(t *testing.T) {
+	bus := New[int]()
+	defer bus.Close()
+	topic := bus.Topic("t")
+
+	var calls int
+	var sub *Subscription[int]
+	sub = topic.Subscribe(func(ev Event[int]) {
+		calls++
+		sub.Unsubscribe()
+	})
+	topic.Publish(context.Background(), 1)
+	topic.Publish(context.Background(), 2)
+	if calls != 1 {
+		t.Fatalf("calls = %d, 取消订阅后不应该再收到事件", calls)
+	}
+	sub.Unsubscribe() // 重复取消是安全的
+}
+
+// 异步订阅者缓冲区满时 Publish 等待，ctx 结束后返回，但仍投递给其他有空位的订阅者
+func TestAsyncBackpressure(t *testing.T) {
+	bus := New[int]()
+	topic := bus.Topic("t")
+
+	release := make(chan struct{})
+	topic.Subscribe(func(ev Event[int]) { <-release }, Async(1))
+	fast := make(chan int, 3)
+	topic.Subscribe(func(ev Event[int]) { fast <- ev.Data }, Async(100))
+
+	// 第一个事件被慢订阅者取走处理，第二个占满缓冲区
+	topic.Publish(context.Background(), 1)
+	topic.Publish(context.Background(), 2)
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := topic.Publish(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+
+	for want := 1; want <= 3; want++ {
+		if got := <-fast; got != want {
+			t.Fatalf("快订阅者收到 %d, want %d", got, want)
+		}
+	}
+	close(release)
+	bus.Close()
+}
+
+func TestClose(t *testing.T) {
+	bus := New[int]()
+	topic := bus.Topic("t")
+	var calls atomic.Int32
+	topic.Subscribe(func(Event[int]) { calls.Add(1) }, Async(1))
+
+	bus.Close()
+	if err := topic.Publish(context.Background(), 1); err != ErrClosed {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+	if err := bus.Topic("new").Publish(context.Background(), 1); err != ErrClosed {
+		t.Fatalf("关闭后创建的 topic: err = %v, want ErrClosed", err)
+	}
+	topic.Subscribe(func(Event[int]) { calls.Add(1) })
+	if calls.Load() != 0 {
+		t.Fatalf("calls = %d", calls.Load())
+	}
+}
@@ -0,0 +1,128 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func collect(t *testing.T, topic *Topic[int], opts ...SubscribeOption) (*Subscription[int], func() []uint64) {
+	t.Helper()
+	var mu sync.Mutex
+	var seqs []uint64
+	sub := topic.Subscribe(func(ev Event[int]) {
+		mu.Lock()
+		seqs = append(seqs, ev.Seq)
+		mu.Unlock()
+	}, opts...)
+	return sub, func() []uint64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uint64(nil), seqs...)
+	}
+}
+
+func expectSeqs(t *testing.T, got []uint64, from, to uint64) {
+	t.Helper()
+	if uint64(len(got)) != to-from+1 {
+		t.Fatalf("got %v, want %d..%d", got, from, to)
+	}
+	for i, seq := range got {
+		if seq != from+uint64(i) {
+			t.Fatalf("got %v, want %d..%d", got, from, to)
+		}
+	}
+}
+
+// 没有 History 时，Broadcast 之后才订阅的订阅者错过了事件；有了 History 可以补上
+func TestLateSubscriberReplay(t *testing.T) {
+	bus := New[int](WithHistory(5))
+	defer bus.Close()
+	topic := bus.Topic("clicked")
+	for i := 0; i < 8; i++ {
+		topic.Publish(context.Background(), i)
+	}
+
+	_, none := collect(t, topic)
+	_, last3 := collect(t, topic, Last(3))
+	_, lastAll := collect(t, topic, Last(100))
+	_, since7 := collect(t, topic, Since(7))
+	_, since1 := collect(t, topic, Since(1))
+
+	if len(none()) != 0 {
+		t.Fatalf("默认订阅不应该回放历史: %v", none())
+	}
+	expectSeqs(t, last3(), 6, 8)
+	expectSeqs(t, lastAll(), 4, 8) // 只保留了最近 5 个
+	expectSeqs(t, since7(), 7, 8)
+	expectSeqs(t, since1(), 4, 8) // 更早的已经被挤出，第一个 Seq 暴露出缺口
+
+	topic.Publish(context.Background(), 8)
+	expectSeqs(t, last3(), 6, 9)
+	expectSeqs(t, none(), 9, 9)
+}
+
+func TestReplayWithoutHistory(t *testing.T) {
+	bus := New[int]()
+	defer bus.Close()
+	topic := bus.Topic("t")
+	topic.Publish(context.Background(), 1)
+
+	_, got := collect(t, topic, Last(10))
+	topic.Publish(context.Background(), 2)
+	expectSeqs(t, got(), 2, 2)
+}
+
+// 发布者持续发布的同时订阅：历史与新事件之间既没有缺口也没有重复
+func TestReplayHandoffIsGapFree(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		bus := New[int](WithHistory(64))
+		topic := bus.Topic("t")
+
+		const total = 2000
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < total; i++ {
+				topic.Publish(context.Background(), i)
+			}
+		}()
+
+		var results []func() []uint64
+		for i := 0; i < 20; i++ {
+			opts := []SubscribeOption{Last(10)}
+			if async {
+				opts = append(opts, Async(total))
+			}
+			_, got := collect(t, topic, opts...)
+			results = append(results, got)
+		}
+		wg.Wait()
+		// 异步订阅者可能还在处理缓冲区，等它们都收到最后一个事件
+		deadline := time.Now().Add(5 * time.Second)
+		for _, got := range results {
+			for {
+				seqs := got()
+				if len(seqs) > 0 && seqs[len(seqs)-1] == total {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("async=%v 订阅者没有收到最后一个事件: %d 个", async, len(seqs))
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		bus.Close()
+
+		for i, got := range results {
+			seqs := got()
+			for j := 1; j < len(seqs); j++ {
+				if seqs[j] != seqs[j-1]+1 {
+					t.Fatalf("async=%v 订阅者 %d 在 %d 之后收到 %d", async, i, seqs[j-1], seqs[j])
+				}
+			}
+		}
+	}
+}
@@ -1,3 +1,3 @@
 module review
 
-go 1.22
+go 1.24
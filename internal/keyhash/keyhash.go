@@ -0,0 +1,11 @@
+// Package keyhash 为任意可比较类型的键计算哈希，cmap 按它分片，syncx 按它分段加锁，
+// 同一个键在两边的行为一致。
+package keyhash
+
+import "hash/maphash"
+
+// Hash 计算键的哈希值，与 == 的语义一致：指针和 channel 按身份计算，与所指向的内容无关；
+// +0 和 -0 相等，包括作为结构体字段时。
+func Hash[K comparable](seed maphash.Seed, k K) uint64 {
+	return maphash.Comparable(seed, k)
+}
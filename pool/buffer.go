@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	minBufferShift       = 6 // 最小的档位 64 字节
+	defaultMaxBufferSize = 64 << 10
+)
+
+// BufferStats 是 BufferPool 的分配统计。
+type BufferStats struct {
+	Hits    uint64 // 从池中取到的次数
+	Misses  uint64 // 档位内但池中没有、只能新分配的次数
+	New     uint64 // 新分配的次数，包括超过上限的请求
+	Dropped uint64 // 因为过大或过小没有放回池中的次数
+}
+
+// BufferPool 按 2 的幂分档缓存字节切片，Get 返回容量足够的最小档位的切片。
+// 大小差别很大的缓冲区混在一个 sync.Pool 里，要么浪费内存，要么取出来不够用；分档之后各取所需。
+//
+// 超过上限的缓冲区不放回池中，避免偶尔一次大请求让池长期占着大块内存。
+type BufferPool struct {
+	maxShift int
+	classes  []sync.Pool // 第 i 档的容量是 1 << (minBufferShift + i)
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+	news     atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// boxes 缓存放进 sync.Pool 的 *[]byte，Put 时不必每次为切片头分配内存。
+var boxes sync.Pool
+
+// NewBufferPool 创建一个最多缓存 maxSize 字节缓冲区的池，maxSize 向上取到 2 的幂，<= 0 时用 64KB。
+func NewBufferPool(maxSize int) *BufferPool {
+	if maxSize <= 0 {
+		maxSize = defaultMaxBufferSize
+	}
+	maxShift := bufferShift(maxSize)
+	return &BufferPool{
+		maxShift: maxShift,
+		classes:  make([]sync.Pool, maxShift-minBufferShift+1),
+	}
+}
+
+// Get 返回长度为 n 的切片，容量至少是不小于 n 的最小的 2 的幂。内容是上一个使用者留下的，需要时自己清零。
+// n 超过上限时直接分配，不经过池。
+func (p *BufferPool) Get(n int) []byte {
+	if n < 0 {
+		panic("pool: 缓冲区长度为负数")
+	}
+	shift := bufferShift(n)
+	if shift > p.maxShift {
+		p.news.Add(1)
+		return make([]byte, n)
+	}
+
+	if box, _ := p.classes[shift-minBufferShift].Get().(*[]byte); box != nil {
+		b := *box
+		*box = nil
+		boxes.Put(box)
+		p.hits.Add(1)
+		return b[:n]
+	}
+	p.misses.Add(1)
+	p.news.Add(1)
+	return make([]byte, n, 1<<shift)
+}
+
+// Put 把 b 放回容量对应的档位，容量不是 2 的幂时放进向下取整的档位。
+// 超过上限或小于最小档位的切片被丢弃。调用方此后不能再使用 b。
+func (p *BufferPool) Put(b []byte) {
+	shift := bits.Len(uint(cap(b))) - 1
+	if shift < minBufferShift || shift > p.maxShift {
+		p.dropped.Add(1)
+		return
+	}
+	box, _ := boxes.Get().(*[]byte)
+	if box == nil {
+		box = new([]byte)
+	}
+	*box = b[:0]
+	p.classes[shift-minBufferShift].Put(box)
+}
+
+// bufferShift 返回能装下 n 字节的最小档位。
+func bufferShift(n int) int {
+	if n <= 1<<minBufferShift {
+		return minBufferShift
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// Stats 返回当前的分配统计。
+func (p *BufferPool) Stats() BufferStats {
+	return BufferStats{
+		Hits:    p.hits.Load(),
+		Misses:  p.misses.Load(),
+		New:     p.news.Load(),
+		Dropped: p.dropped.Load(),
+	}
+}
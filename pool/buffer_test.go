@@ -0,0 +1,155 @@
+package pool
+
+import (
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"testing"
+)
+
+func TestBufferSizeClasses(t *testing.T) {
+	p := NewBufferPool(1 << 16)
+	for _, tc := range []struct{ n, cap int }{
+		{0, 64},
+		{1, 64},
+		{64, 64},
+		{65, 128},
+		{1000, 1024},
+		{1024, 1024},
+		{1 << 16, 1 << 16},
+	} {
+		b := p.Get(tc.n)
+		if len(b) != tc.n || cap(b) != tc.cap {
+			t.Errorf("Get(%d): len = %d, cap = %d, want cap %d", tc.n, len(b), cap(b), tc.cap)
+		}
+	}
+	if b := p.Get(1<<16 + 1); len(b) != 1<<16+1 {
+		t.Fatalf("超过上限的请求 len = %d", len(b))
+	}
+	if s := p.Stats(); s.New != 8 || s.Misses != 7 || s.Hits != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestBufferReuse(t *testing.T) {
+	// 关掉 GC，避免 sync.Pool 在测试中途被清空
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	p := NewBufferPool(0)
+	b := p.Get(1000)
+	b[0] = 'x'
+
+	// 同一档位内的任何长度都能取到它
+	got := putThenGet(t, p, b, 600)
+	if len(got) != 600 || cap(got) != 1024 || got[0] != 'x' {
+		t.Fatalf("len = %d, cap = %d, 应该复用放回的缓冲区", len(got), cap(got))
+	}
+	if s := p.Stats(); s.Hits != 1 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+// putThenGet 放回 b 再取出 n 字节，直到命中为止。-race 下 sync.Pool 会随机丢掉一部分 Put。
+func putThenGet(t *testing.T, p *BufferPool, b []byte, n int) []byte {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		hits := p.Stats().Hits
+		p.Put(b)
+		if got := p.Get(n); p.Stats().Hits > hits {
+			return got
+		}
+	}
+	t.Fatal("放回的缓冲区一直没有被取到")
+	return nil
+}
+
+func TestBufferPutRefusesOversized(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	p := NewBufferPool(4096)
+	p.Put(make([]byte, 8192))
+	p.Put(make([]byte, 10))
+	if s := p.Stats(); s.Dropped != 2 {
+		t.Fatalf("Dropped = %d, want 2", s.Dropped)
+	}
+
+	// 容量不是 2 的幂的切片放进向下取整的档位，取出来仍然够用
+	if b := putThenGet(t, p, make([]byte, 0, 3000), 2048); cap(b) != 3000 {
+		t.Fatalf("cap = %d, want 3000", cap(b))
+	}
+}
+
+// 与 TestPool 的 calcPool 一样大量并发地取用和归还，计数在 -race 下没有数据竞争
+func TestBufferConcurrent(t *testing.T) {
+	p := NewBufferPool(0)
+	var wg sync.WaitGroup
+	const workers, each = 16, 1000
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for j := 0; j < each; j++ {
+				n := rng.Intn(8192)
+				b := p.Get(n)
+				if len(b) != n {
+					t.Errorf("len = %d, want %d", len(b), n)
+				}
+				p.Put(b)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	s := p.Stats()
+	if s.Hits+s.Misses != workers*each {
+		t.Fatalf("Hits + Misses = %d, want %d", s.Hits+s.Misses, workers*each)
+	}
+	if s.New != s.Misses {
+		t.Fatalf("New = %d, Misses = %d", s.New, s.Misses)
+	}
+}
+
+var benchSizes = func() []int {
+	rng := rand.New(rand.NewSource(1))
+	sizes := make([]int, 1024)
+	for i := range sizes {
+		// 编码器的缓冲区大小跨好几个数量级
+		sizes[i] = 1 << rng.Intn(16)
+		sizes[i] += rng.Intn(sizes[i])
+	}
+	return sizes
+}()
+
+var sink []byte
+
+func BenchmarkBufferPool(b *testing.B) {
+	p := NewBufferPool(0)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			buf := p.Get(benchSizes[i%len(benchSizes)])
+			buf[0] = 1
+			p.Put(buf)
+			i++
+		}
+	})
+	s := p.Stats()
+	b.ReportMetric(float64(s.Hits)/float64(s.Hits+s.Misses), "hit-ratio")
+}
+
+func BenchmarkMake(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			buf := make([]byte, benchSizes[i%len(benchSizes)])
+			buf[0] = 1
+			sink = buf
+			i++
+		}
+	})
+	runtime.KeepAlive(sink)
+}
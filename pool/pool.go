@@ -0,0 +1,255 @@
+package pool
+
+import (
+	"hash"
+	"hash/fnv"
+	"maps"
+	"math"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool 是带类型的 sync.Pool，取出来就是 *T，不需要类型断言。零值可用，此时用 new(T) 创建对象。
+//
+// 调用 Debug 之后进入调试模式，用来在测试中发现误用：重复 Put、Put 之后继续使用，以及取出后没有还回来的对象。
+type Pool[T any] struct {
+	// New 创建新对象，为 nil 时用 new(T)。
+	New func() *T
+	// Reset 在 Put 时把对象恢复到可以复用的状态，例如把切片截成零长度。
+	Reset func(*T)
+	// Poison 只在调试模式下使用：在 Reset 之后往对象里填上一眼能认出来的垃圾，
+	// 让 Put 之后还在读对象的代码尽早出错。Get 时再调用 Reset 恢复。
+	Poison func(*T)
+
+	p     sync.Pool
+	debug atomic.Pointer[debugState[T]]
+}
+
+// Get 取出一个对象，池中没有时新建一个。
+func (p *Pool[T]) Get() *T {
+	if d := p.debug.Load(); d != nil {
+		return d.get(p)
+	}
+	if x, _ := p.p.Get().(*T); x != nil {
+		return x
+	}
+	return p.newObject()
+}
+
+// Put 把 x 放回池中。之后调用方不能再使用 x。
+func (p *Pool[T]) Put(x *T) {
+	if x == nil {
+		return
+	}
+	if d := p.debug.Load(); d != nil {
+		d.put(p, x)
+		return
+	}
+	if p.Reset != nil {
+		p.Reset(x)
+	}
+	p.p.Put(x)
+}
+
+func (p *Pool[T]) newObject() *T {
+	if p.New != nil {
+		return p.New()
+	}
+	return new(T)
+}
+
+// TB 是 testing.TB 中调试模式用到的部分，这样 pool 包不必依赖 testing。
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Cleanup(func())
+}
+
+// Debug 让 p 在 tb 所在的测试期间进入调试模式，误用通过 tb.Errorf 报告：
+//
+//   - 重复 Put 同一个对象；
+//   - Put 之后修改对象：对象先在池中隔离一段时间，再次借出前检查内容有没有变；
+//   - 测试结束时还有借出未还的对象，报告它们被取出的位置。
+//
+// 调试模式下对象不经过 sync.Pool，每次操作都记录调用栈，只应在测试中使用。测试结束后恢复普通模式。
+func (p *Pool[T]) Debug(tb TB) {
+	tb.Helper()
+	d := &debugState[T]{tb: tb, objs: make(map[*T]*objState)}
+	p.debug.Store(d)
+	tb.Cleanup(func() {
+		p.debug.CompareAndSwap(d, nil)
+		d.checkLeaks()
+	})
+}
+
+type debugState[T any] struct {
+	tb TB
+
+	mu   sync.Mutex
+	objs map[*T]*objState
+	free []*T // 按 Put 的顺序，先放回的先借出，隔离时间尽量长
+}
+
+type objState struct {
+	inPool bool
+	stack  []byte // 最近一次 Get 或 Put 的调用栈
+	sum    uint64 // 放回池中时内容的指纹
+}
+
+func (d *debugState[T]) get(p *Pool[T]) *T {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var x *T
+	if len(d.free) > 0 {
+		x = d.free[0]
+		d.free[0] = nil
+		d.free = d.free[1:]
+		st := d.objs[x]
+		if fingerprint(x) != st.sum {
+			d.tb.Errorf("pool: 对象在 Put 之后被修改，Put 于:\n%s", st.stack)
+		}
+		if p.Reset != nil {
+			p.Reset(x)
+		}
+	} else {
+		x = p.newObject()
+	}
+	d.objs[x] = &objState{stack: debug.Stack()}
+	return x
+}
+
+func (d *debugState[T]) put(p *Pool[T], x *T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.objs[x]
+	if ok && st.inPool {
+		d.tb.Errorf("pool: 对象被重复 Put，第一次 Put 于:\n%s\n第二次 Put 于:\n%s", st.stack, debug.Stack())
+		return
+	}
+	if p.Reset != nil {
+		p.Reset(x)
+	}
+	if p.Poison != nil {
+		p.Poison(x)
+	}
+	d.objs[x] = &objState{inPool: true, stack: debug.Stack(), sum: fingerprint(x)}
+	d.free = append(d.free, x)
+}
+
+// maxLeakReports 限制报告泄漏时列出的调用栈个数。
+const maxLeakReports = 5
+
+func (d *debugState[T]) checkLeaks() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var stacks []string
+	for _, st := range d.objs {
+		if !st.inPool {
+			stacks = append(stacks, string(st.stack))
+		}
+	}
+	if len(stacks) == 0 {
+		return
+	}
+	n := len(stacks)
+	if n > maxLeakReports {
+		stacks = stacks[:maxLeakReports]
+	}
+	d.tb.Errorf("pool: %d 个对象取出后没有 Put 回来，取出于:\n%s", n, strings.Join(stacks, "\n"))
+}
+
+// fingerprint 计算 *x 可达内容的哈希，会跟进指针、切片和 map，用来发现 Put 之后的修改。
+func fingerprint[T any](x *T) uint64 {
+	h := fnv.New64a()
+	hashValue(h, reflect.ValueOf(x).Elem(), make(map[uintptr]bool))
+	return h.Sum64()
+}
+
+func hashValue(h hash.Hash64, v reflect.Value, seen map[uintptr]bool) {
+	var buf [8]byte
+	writeUint := func(u uint64) {
+		for i := range buf {
+			buf[i] = byte(u >> (8 * i))
+		}
+		h.Write(buf[:])
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			writeUint(1)
+		} else {
+			writeUint(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeUint(math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeUint(math.Float64bits(real(c)))
+		writeUint(math.Float64bits(imag(c)))
+	case reflect.String:
+		writeUint(uint64(v.Len()))
+		h.Write([]byte(v.String()))
+	case reflect.Slice:
+		writeUint(uint64(v.Pointer()))
+		writeUint(uint64(v.Len()))
+		writeUint(uint64(v.Cap()))
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// 连同 len 之后、cap 之内的部分一起，buf[:0] 之后往底层数组里写也能发现
+			h.Write(v.Slice(0, v.Cap()).Bytes())
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i), seen)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i), seen)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i), seen)
+		}
+	case reflect.Pointer:
+		writeUint(uint64(v.Pointer()))
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		hashValue(h, v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			writeUint(0)
+			return
+		}
+		h.Write([]byte(v.Elem().Type().String()))
+		hashValue(h, v.Elem(), seen)
+	case reflect.Map:
+		// map 的遍历顺序不固定，各条目的哈希按异或合并。每个条目用自己的 seen 副本，
+		// 否则两个条目指向同一个指针时，先遍历到的那个才会展开它，结果随遍历顺序变化
+		writeUint(uint64(v.Len()))
+		var sum uint64
+		iter := v.MapRange()
+		for iter.Next() {
+			eh := fnv.New64a()
+			es := maps.Clone(seen)
+			hashValue(eh, iter.Key(), es)
+			hashValue(eh, iter.Value(), es)
+			sum ^= eh.Sum64()
+		}
+		writeUint(sum)
+	default:
+		// chan、func 等只比较身份
+		writeUint(uint64(v.Pointer()))
+	}
+}
@@ -0,0 +1,228 @@
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 用 Pool[T] 重写 TestPool 的 calcPool：不需要 .(*[]byte)，计数也没有数据竞争
+func TestPoolTyped(t *testing.T) {
+	var created atomic.Int32
+	calcPool := &Pool[[]byte]{
+		New: func() *[]byte {
+			created.Add(1)
+			mem := make([]byte, 1024)
+			return &mem
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mem := calcPool.Get()
+			defer calcPool.Put(mem)
+			if len(*mem) != 1024 {
+				t.Errorf("len = %d", len(*mem))
+			}
+		}()
+	}
+	wg.Wait()
+	t.Logf("%d calculators were created.", created.Load())
+	if n := created.Load(); n > 1000 {
+		t.Fatalf("创建了 %d 个, 最多应该是 1000 个", n)
+	}
+}
+
+func TestPoolReset(t *testing.T) {
+	p := &Pool[bytes.Buffer]{Reset: (*bytes.Buffer).Reset}
+	p.Debug(t) // 调试模式下不经过 sync.Pool，取回的一定是刚放回的那个
+
+	b := p.Get()
+	b.WriteString("hello")
+	p.Put(b)
+	if got := p.Get(); got != b || got.Len() != 0 {
+		t.Fatalf("got %p %q, 应该是重置过的 %p", got, got.String(), b)
+	}
+	p.Put(b)
+}
+
+func TestPoolZeroValue(t *testing.T) {
+	var p Pool[int]
+	x := p.Get()
+	if x == nil || *x != 0 {
+		t.Fatal("零值的 Pool 应该用 new(T) 创建对象")
+	}
+	p.Put(x)
+	p.Put(nil)
+}
+
+// recorder 记录调试模式报告的错误，代替真正的 testing.T
+type recorder struct {
+	mu       sync.Mutex
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+// finish 模拟测试结束，返回所有报告的错误
+func (r *recorder) finish() []string {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errs
+}
+
+func expectReport(t *testing.T, errs []string, substr string) {
+	t.Helper()
+	if len(errs) != 1 || !strings.Contains(errs[0], substr) {
+		t.Fatalf("errs = %q, want 一条包含 %q 的报告", errs, substr)
+	}
+}
+
+func newBufPool() *Pool[[]byte] {
+	return &Pool[[]byte]{
+		New: func() *[]byte {
+			b := make([]byte, 0, 64)
+			return &b
+		},
+		Reset: func(b *[]byte) { *b = (*b)[:0] },
+		Poison: func(b *[]byte) {
+			full := (*b)[:cap(*b)]
+			for i := range full {
+				full[i] = 0xDB
+			}
+		},
+	}
+}
+
+func TestDebugDoublePut(t *testing.T) {
+	var r recorder
+	p := newBufPool()
+	p.Debug(&r)
+
+	b := p.Get()
+	p.Put(b)
+	p.Put(b)
+	expectReport(t, r.finish(), "重复 Put")
+}
+
+func TestDebugUseAfterPut(t *testing.T) {
+	var r recorder
+	p := newBufPool()
+	p.Debug(&r)
+
+	b := p.Get()
+	*b = append(*b, "hello"...)
+	alias := *b // 与 b 共享底层数组
+	p.Put(b)
+
+	// Poison 之后，Put 之后还在读的代码看到的是垃圾
+	if alias[0] != 0xDB {
+		t.Fatalf("alias[0] = %#x, 应该已经被 Poison", alias[0])
+	}
+	// Put 之后通过别名写入，下次借出时被发现
+	alias[0] = 'x'
+	got := p.Get()
+	p.Put(got)
+	expectReport(t, r.finish(), "Put 之后被修改")
+}
+
+func TestDebugLeak(t *testing.T) {
+	var r recorder
+	p := newBufPool()
+	p.Debug(&r)
+
+	p.Get()
+	p.Put(p.Get())
+	p.Get()
+	expectReport(t, r.finish(), "2 个对象取出后没有 Put 回来")
+
+	// 测试结束后恢复普通模式
+	if p.debug.Load() != nil {
+		t.Fatal("Cleanup 之后应该退出调试模式")
+	}
+}
+
+func TestDebugCleanUsage(t *testing.T) {
+	var r recorder
+	p := newBufPool()
+	p.Debug(&r)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := p.Get()
+			*b = append(*b, byte(i))
+			p.Put(b)
+		}()
+	}
+	wg.Wait()
+	if errs := r.finish(); len(errs) != 0 {
+		t.Fatalf("正确的用法不应该报告错误: %q", errs)
+	}
+}
+
+// 指纹跟进指针、map 和未导出字段
+func TestFingerprint(t *testing.T) {
+	type node struct {
+		name  string
+		attrs map[string]int
+		next  *node
+	}
+	a := &node{name: "a", attrs: map[string]int{"x": 1}}
+	a.next = &node{name: "b", next: a}
+
+	sum := fingerprint(a)
+	if fingerprint(a) != sum {
+		t.Fatal("内容不变时指纹应该相同")
+	}
+	for _, mutate := range []func(){
+		func() { a.next.name = "c" },
+		func() { a.attrs["x"] = 2 },
+		func() { a.attrs["y"] = 1 },
+	} {
+		mutate()
+		if next := fingerprint(a); next == sum {
+			t.Fatal("修改后指纹应该改变")
+		} else {
+			sum = next
+		}
+	}
+}
+
+// map 的多个条目指向同一个指针时，指纹不能随 map 的遍历顺序变化
+func TestFingerprintSharedPointerInMap(t *testing.T) {
+	type leaf struct{ n int }
+	shared := &leaf{n: 1}
+	m := map[int]*leaf{}
+	for i := 0; i < 16; i++ {
+		m[i] = shared
+	}
+	sum := fingerprint(&m)
+	for i := 0; i < 100; i++ {
+		if got := fingerprint(&m); got != sum {
+			t.Fatalf("第 %d 次指纹 = %x, want %x", i, got, sum)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Package pool 提供 sync.Pool 之外的池：有上限、可校验的资源池，按大小分档的字节缓冲池，
+// 以及带类型、能在测试中发现误用的对象池。
+// sync.Pool 中的对象随时可能被 GC 丢掉，也没有数量上限，不适合用来管理连接这类资源。
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultMaxIdle = 2
+
+// ErrClosed 表示资源池已经关闭。
+var ErrClosed = errors.New("pool: 资源池已关闭")
+
+// Option 配置资源类型为 T 的 ResourcePool。WithValidate 和 WithClose 能从回调推断出 T，
+// 其他选项需要显式写出类型参数，例如 WithMaxOpen[*sql.Conn](10)。
+type Option[T any] func(*options[T])
+
+type options[T any] struct {
+	maxOpen     int
+	maxIdle     int
+	idleTimeout time.Duration
+	validate    func(ctx context.Context, v T) error
+	close       func(v T)
+	now         func() time.Time
+}
+
+// WithMaxOpen 设置同时打开（借出加空闲）的资源上限，<= 0 表示不限，默认不限。
+// 达到上限后 Acquire 排队等待。
+func WithMaxOpen[T any](n int) Option[T] {
+	return func(o *options[T]) {
+		o.maxOpen = n
+	}
+}
+
+// WithMaxIdle 设置最多保留的空闲资源数，默认 2，< 0 表示不保留。超过上限的资源在归还时直接关闭。
+func WithMaxIdle[T any](n int) Option[T] {
+	return func(o *options[T]) {
+		o.maxIdle = n
+	}
+}
+
+// WithIdleTimeout 设置空闲资源的最长保留时间，超时的资源被关闭而不是借出，<= 0 表示不超时。
+func WithIdleTimeout[T any](d time.Duration) Option[T] {
+	return func(o *options[T]) {
+		o.idleTimeout = d
+	}
+}
+
+// WithValidate 设置借出前的校验，例如 ping 一下连接。校验失败的资源被关闭，Acquire 换一个再试。
+// 只校验复用的资源，新打开的不校验。
+func WithValidate[T any](fn func(ctx context.Context, v T) error) Option[T] {
+	return func(o *options[T]) {
+		o.validate = fn
+	}
+}
+
+// WithClose 设置关闭资源的方式，在池的锁之外调用。
+func WithClose[T any](fn func(v T)) Option[T] {
+	return func(o *options[T]) {
+		o.close = fn
+	}
+}
+
+// WithClock 替换资源池使用的时钟，测试中可以用假时钟驱动空闲超时。
+func WithClock[T any](now func() time.Time) Option[T] {
+	return func(o *options[T]) {
+		o.now = now
+	}
+}
+
+// Stats 是资源池的运行统计。
+type Stats struct {
+	MaxOpen int // 同时打开的上限，0 表示不限
+	Open    int // 已打开的资源数，包括正在打开的
+	InUse   int // 借出的资源数
+	Idle    int // 空闲的资源数
+
+	WaitCount         int64         // 因池满而等待的 Acquire 次数
+	WaitDuration      time.Duration // 等待的总时长
+	MaxIdleClosed     int64         // 因超过 MaxIdle 关闭的资源数
+	IdleTimeoutClosed int64         // 因空闲超时关闭的资源数
+	ValidationFailed  int64         // 借出前校验失败关闭的资源数
+}
+
+// ResourcePool 是有上限的资源池，例如数据库或 TCP 连接池。
+//
+// 池满时 Acquire 按到达顺序排队：归还的资源直接交给等得最久的调用方，不会被后来的调用方抢走。
+type ResourcePool[T any] struct {
+	open        func(ctx context.Context) (T, error)
+	validate    func(ctx context.Context, v T) error
+	close       func(v T)
+	maxOpen     int
+	maxIdle     int
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	idle    []*entry[T] // 按放回时间排序，借出时取最新的
+	numOpen int
+	waiters []chan grant[T]
+	closed  bool
+	stats   Stats
+	stop    chan struct{}
+}
+
+type entry[T any] struct {
+	v         T
+	idleSince time.Time
+}
+
+// grant 是交给排队者的一个名额：e 非空时带着可用的资源，否则排队者自己打开一个。
+type grant[T any] struct {
+	e   *entry[T]
+	err error
+}
+
+// New 创建一个用 open 打开资源的池。设置了空闲超时时会启动一个清理空闲资源的 goroutine，由 Close 停止。
+func New[T any](open func(ctx context.Context) (T, error), opts ...Option[T]) *ResourcePool[T] {
+	o := options[T]{maxIdle: defaultMaxIdle, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p := &ResourcePool[T]{
+		open:        open,
+		validate:    o.validate,
+		close:       o.close,
+		maxOpen:     max(o.maxOpen, 0),
+		maxIdle:     max(o.maxIdle, 0),
+		idleTimeout: o.idleTimeout,
+		now:         o.now,
+		stop:        make(chan struct{}),
+	}
+	if p.maxOpen > 0 {
+		p.maxIdle = min(p.maxIdle, p.maxOpen)
+	}
+	if p.idleTimeout > 0 {
+		go p.cleaner()
+	}
+	return p
+}
+
+// Resource 是借出的一个资源，用完后必须调用且只能调用一次 Release 或 Discard。
+type Resource[T any] struct {
+	p        *ResourcePool[T]
+	e        *entry[T]
+	returned bool
+}
+
+// Value 返回资源本身。
+func (r *Resource[T]) Value() T {
+	return r.e.v
+}
+
+// Release 把资源还给池，交给排队者或者留作空闲。
+func (r *Resource[T]) Release() {
+	r.markReturned()
+	r.p.mu.Lock()
+	toClose := r.p.put(r.e)
+	r.p.mu.Unlock()
+	r.p.closeAll(toClose)
+}
+
+// Discard 关闭资源而不还给池，用于已经损坏的资源，例如出错的连接。
+func (r *Resource[T]) Discard() {
+	r.markReturned()
+	r.p.closeAll([]*entry[T]{r.e})
+	r.p.mu.Lock()
+	r.p.releaseSlot()
+	r.p.mu.Unlock()
+}
+
+func (r *Resource[T]) markReturned() {
+	if r.returned {
+		panic("pool: 资源被重复归还")
+	}
+	r.returned = true
+}
+
+// Acquire 借出一个资源：优先复用空闲的，没有空闲且未达上限时打开新的，否则排队等待。
+// ctx 结束时放弃等待并返回 ctx.Err()；池关闭后返回 ErrClosed。
+func (p *ResourcePool[T]) Acquire(ctx context.Context) (*Resource[T], error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	// 有排队者时不可能有空闲资源或者空余名额，新来的也必须排队
+	var expired []*entry[T]
+	if len(p.waiters) == 0 {
+		var e *entry[T]
+		e, expired = p.popIdle()
+		if e != nil || p.maxOpen == 0 || p.numOpen < p.maxOpen {
+			if e == nil {
+				p.numOpen++
+			}
+			p.mu.Unlock()
+			p.closeAll(expired)
+			return p.ready(ctx, e)
+		}
+	}
+
+	w := make(chan grant[T], 1)
+	p.waiters = append(p.waiters, w)
+	p.stats.WaitCount++
+	start := p.now()
+	p.mu.Unlock()
+	p.closeAll(expired)
+
+	select {
+	case g := <-w:
+		p.mu.Lock()
+		p.stats.WaitDuration += p.now().Sub(start)
+		p.mu.Unlock()
+		if g.err != nil {
+			return nil, g.err
+		}
+		return p.ready(ctx, g.e)
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	p.stats.WaitDuration += p.now().Sub(start)
+	var toClose []*entry[T]
+	if !p.removeWaiter(w) {
+		// 名额已经交给了我们，转交下一个排队者
+		if g := <-w; g.err == nil {
+			if g.e != nil {
+				toClose = p.put(g.e)
+			} else {
+				p.releaseSlot()
+			}
+		}
+	}
+	p.mu.Unlock()
+	p.closeAll(toClose)
+	return nil, ctx.Err()
+}
+
+// ready 在持有一个名额时调用：校验 e，不可用或 e 为空时用这个名额打开新资源。
+func (p *ResourcePool[T]) ready(ctx context.Context, e *entry[T]) (*Resource[T], error) {
+	for e != nil && p.validate != nil {
+		if err := p.validate(ctx, e.v); err == nil {
+			break
+		}
+		p.closeAll([]*entry[T]{e})
+		p.mu.Lock()
+		p.stats.ValidationFailed++
+		// 名额还是我们的，能换一个空闲资源就把多出来的名额还回去
+		var expired []*entry[T]
+		e, expired = p.popIdle()
+		if e != nil {
+			p.numOpen--
+		}
+		p.mu.Unlock()
+		p.closeAll(expired)
+	}
+	if e != nil {
+		return &Resource[T]{p: p, e: e}, nil
+	}
+
+	v, err := p.open(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.releaseSlot()
+		p.mu.Unlock()
+		return nil, err
+	}
+	return &Resource[T]{p: p, e: &entry[T]{v: v}}, nil
+}
+
+// popIdle 取出最新的未超时空闲资源，同时摘掉已经超时的，由调用方在锁外关闭。调用时必须持有 p.mu。
+func (p *ResourcePool[T]) popIdle() (e *entry[T], expired []*entry[T]) {
+	expired = p.expireIdle()
+	n := len(p.idle)
+	if n == 0 {
+		return nil, expired
+	}
+	e = p.idle[n-1]
+	p.idle[n-1] = nil
+	p.idle = p.idle[:n-1]
+	return e, expired
+}
+
+// put 把 e 交给等得最久的排队者或者放回空闲列表，返回需要在锁外关闭的资源。调用时必须持有 p.mu。
+func (p *ResourcePool[T]) put(e *entry[T]) []*entry[T] {
+	if len(p.waiters) > 0 {
+		p.grantNext(grant[T]{e: e})
+		return nil
+	}
+	if p.closed || len(p.idle) >= p.maxIdle {
+		p.numOpen--
+		if !p.closed {
+			p.stats.MaxIdleClosed++
+		}
+		return []*entry[T]{e}
+	}
+	e.idleSince = p.now()
+	p.idle = append(p.idle, e)
+	return p.expireIdle()
+}
+
+// releaseSlot 归还一个没有资源的名额：有排队者就交给它，否则减少打开数。调用时必须持有 p.mu。
+func (p *ResourcePool[T]) releaseSlot() {
+	if len(p.waiters) > 0 {
+		p.grantNext(grant[T]{})
+		return
+	}
+	p.numOpen--
+}
+
+func (p *ResourcePool[T]) grantNext(g grant[T]) {
+	w := p.waiters[0]
+	p.waiters[0] = nil
+	p.waiters = p.waiters[1:]
+	w <- g
+}
+
+func (p *ResourcePool[T]) removeWaiter(w chan grant[T]) bool {
+	for i, x := range p.waiters {
+		if x == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// expireIdle 从空闲列表中摘掉超时的资源并返回，调用时必须持有 p.mu。
+func (p *ResourcePool[T]) expireIdle() []*entry[T] {
+	if p.idleTimeout <= 0 {
+		return nil
+	}
+	deadline := p.now().Add(-p.idleTimeout)
+	n := 0
+	for n < len(p.idle) && !p.idle[n].idleSince.After(deadline) {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	expired := append([]*entry[T](nil), p.idle[:n]...)
+	p.idle = append(p.idle[:0], p.idle[n:]...)
+	p.numOpen -= n
+	p.stats.IdleTimeoutClosed += int64(n)
+	return expired
+}
+
+func (p *ResourcePool[T]) closeAll(es []*entry[T]) {
+	if p.close == nil {
+		return
+	}
+	for _, e := range es {
+		p.close(e.v)
+	}
+}
+
+func (p *ResourcePool[T]) cleaner() {
+	t := time.NewTicker(p.idleTimeout)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-p.stop:
+			return
+		}
+		p.mu.Lock()
+		expired := p.expireIdle()
+		p.mu.Unlock()
+		p.closeAll(expired)
+	}
+}
+
+// Stats 返回当前的统计。
+func (p *ResourcePool[T]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.MaxOpen = p.maxOpen
+	s.Open = p.numOpen
+	s.Idle = len(p.idle)
+	s.InUse = p.numOpen - len(p.idle)
+	return s
+}
+
+// Close 关闭池和所有空闲资源，排队者收到 ErrClosed。借出的资源仍然可以使用，归还时被关闭。
+// 重复调用是安全的。
+func (p *ResourcePool[T]) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	idle := p.idle
+	p.idle = nil
+	p.numOpen -= len(idle)
+	for _, w := range p.waiters {
+		w <- grant[T]{err: ErrClosed}
+	}
+	p.waiters = nil
+	p.mu.Unlock()
+	p.closeAll(idle)
+}
@@ -0,0 +1,383 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeConn 是测试用的本地资源，代替真实的数据库连接
+type fakeConn struct {
+	id     int
+	broken atomic.Bool
+	closed atomic.Bool
+}
+
+type dialer struct {
+	opened atomic.Int32
+	closed atomic.Int32
+	fail   atomic.Bool
+}
+
+func (d *dialer) open(ctx context.Context) (*fakeConn, error) {
+	if d.fail.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeConn{id: int(d.opened.Add(1))}, nil
+}
+
+func (d *dialer) close(c *fakeConn) {
+	if c.closed.Swap(true) {
+		panic("连接被关闭了两次")
+	}
+	d.closed.Add(1)
+}
+
+func (d *dialer) pool(opts ...Option[*fakeConn]) *ResourcePool[*fakeConn] {
+	opts = append([]Option[*fakeConn]{WithClose(d.close)}, opts...)
+	return New(d.open, opts...)
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestResourceReuse(t *testing.T) {
+	var d dialer
+	p := d.pool()
+	defer p.Close()
+
+	r, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := r.Value()
+	r.Release()
+
+	r, _ = p.Acquire(context.Background())
+	if r.Value() != first {
+		t.Fatal("空闲的连接应该被复用")
+	}
+	r.Release()
+	if d.opened.Load() != 1 {
+		t.Fatalf("opened = %d, want 1", d.opened.Load())
+	}
+}
+
+// 与 sync.Pool 不同，打开的资源数不会超过上限，超出的 Acquire 按到达顺序排队
+func TestAcquireFairWhenExhausted(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxOpen[*fakeConn](1))
+	defer p.Close()
+
+	held, _ := p.Acquire(context.Background())
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := p.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			r.Release()
+		}()
+		// 等它排上队再启动下一个，保证到达顺序
+		waitFor(t, func() bool { return p.Stats().WaitCount == int64(i+1) })
+	}
+
+	held.Release()
+	wg.Wait()
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("order = %v, 应该按到达顺序", order)
+		}
+	}
+	if s := p.Stats(); s.Open != 1 || d.opened.Load() != 1 {
+		t.Fatalf("Open = %d, opened = %d, 连接应该在排队者之间传递", s.Open, d.opened.Load())
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxOpen[*fakeConn](1))
+	defer p.Close()
+
+	held, _ := p.Acquire(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+
+	s := p.Stats()
+	if s.WaitCount != 1 || s.WaitDuration < 20*time.Millisecond {
+		t.Fatalf("WaitCount = %d, WaitDuration = %v", s.WaitCount, s.WaitDuration)
+	}
+	held.Release()
+	if s := p.Stats(); s.Open != 1 || s.Idle != 1 {
+		t.Fatalf("stats = %+v, 放弃的排队者不应该占着名额", s)
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxIdle[*fakeConn](1))
+	defer p.Close()
+
+	var rs []*Resource[*fakeConn]
+	for i := 0; i < 3; i++ {
+		r, _ := p.Acquire(context.Background())
+		rs = append(rs, r)
+	}
+	for _, r := range rs {
+		r.Release()
+	}
+
+	s := p.Stats()
+	if s.Idle != 1 || s.Open != 1 || s.MaxIdleClosed != 2 || d.closed.Load() != 2 {
+		t.Fatalf("stats = %+v, closed = %d", s, d.closed.Load())
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	var d dialer
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := d.pool(WithIdleTimeout[*fakeConn](time.Minute), WithClock[*fakeConn](clock.Now))
+	defer p.Close()
+
+	r, _ := p.Acquire(context.Background())
+	old := r.Value()
+	r.Release()
+
+	clock.Advance(2 * time.Minute)
+	r, _ = p.Acquire(context.Background())
+	defer r.Release()
+	if r.Value() == old || !old.closed.Load() {
+		t.Fatal("空闲超时的连接应该被关闭，借出新的")
+	}
+	if s := p.Stats(); s.IdleTimeoutClosed != 1 || s.Open != 1 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestIdleTimeoutCleaner(t *testing.T) {
+	var d dialer
+	p := d.pool(WithIdleTimeout[*fakeConn](10 * time.Millisecond))
+	defer p.Close()
+
+	r, _ := p.Acquire(context.Background())
+	r.Release()
+	waitFor(t, func() bool { return d.closed.Load() == 1 })
+	if s := p.Stats(); s.Open != 0 || s.Idle != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestValidateOnBorrow(t *testing.T) {
+	var d dialer
+	p := d.pool(WithValidate(func(ctx context.Context, c *fakeConn) error {
+		if c.broken.Load() {
+			return errors.New("broken pipe")
+		}
+		return nil
+	}))
+	defer p.Close()
+
+	r, _ := p.Acquire(context.Background())
+	bad := r.Value()
+	bad.broken.Store(true)
+	r.Release()
+
+	r, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if r.Value() == bad || !bad.closed.Load() {
+		t.Fatal("校验失败的连接应该被关闭，借出新的")
+	}
+	if s := p.Stats(); s.ValidationFailed != 1 || s.Open != 1 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+// Discard 空出的名额交给排队者，由它打开新连接
+func TestDiscardWakesWaiter(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxOpen[*fakeConn](1))
+	defer p.Close()
+
+	held, _ := p.Acquire(context.Background())
+	got := make(chan *Resource[*fakeConn])
+	go func() {
+		r, _ := p.Acquire(context.Background())
+		got <- r
+	}()
+	waitFor(t, func() bool { return p.Stats().WaitCount == 1 })
+
+	held.Discard()
+	r := <-got
+	if r.Value().id != 2 || !held.Value().closed.Load() {
+		t.Fatal("排队者应该拿到新打开的连接")
+	}
+	r.Release()
+}
+
+func TestOpenErrorFreesSlot(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxOpen[*fakeConn](1))
+	defer p.Close()
+
+	d.fail.Store(true)
+	if _, err := p.Acquire(context.Background()); err == nil {
+		t.Fatal("打开失败应该返回错误")
+	}
+	d.fail.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("打开失败后名额没有归还: %v", err)
+	}
+	r.Release()
+}
+
+func TestDoubleReleasePanics(t *testing.T) {
+	var d dialer
+	p := d.pool()
+	defer p.Close()
+
+	r, _ := p.Acquire(context.Background())
+	r.Release()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("重复归还应该 panic")
+		}
+	}()
+	r.Release()
+}
+
+func TestResourcePoolClose(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxOpen[*fakeConn](2))
+
+	idle, _ := p.Acquire(context.Background())
+	held, _ := p.Acquire(context.Background())
+	idle.Release()
+
+	errc := make(chan error)
+	go func() {
+		p.Acquire(context.Background()) // 拿走空闲的
+		_, err := p.Acquire(context.Background())
+		errc <- err
+	}()
+	waitFor(t, func() bool { return p.Stats().WaitCount == 1 })
+
+	p.Close()
+	if err := <-errc; err != ErrClosed {
+		t.Fatalf("排队者 err = %v, want ErrClosed", err)
+	}
+	if _, err := p.Acquire(context.Background()); err != ErrClosed {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+	held.Release()
+	if !held.Value().closed.Load() {
+		t.Fatal("关闭后归还的连接应该被关闭")
+	}
+	p.Close()
+}
+
+// 大量调用方带着随机超时抢少量连接，结束后名额不多不少
+func TestAcquireStress(t *testing.T) {
+	var d dialer
+	p := d.pool(WithMaxOpen[*fakeConn](3), WithMaxIdle[*fakeConn](3), WithValidate(func(ctx context.Context, c *fakeConn) error {
+		if c.broken.Load() {
+			return errors.New("broken")
+		}
+		return nil
+	}))
+	defer p.Close()
+
+	var inUse atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for j := 0; j < 100; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rng.Intn(200))*time.Microsecond)
+				r, err := p.Acquire(ctx)
+				cancel()
+				if err != nil {
+					continue
+				}
+				if n := inUse.Add(1); n > 3 {
+					t.Errorf("同时借出了 %d 个连接", n)
+				}
+				inUse.Add(-1)
+				switch rng.Intn(10) {
+				case 0:
+					r.Discard()
+				case 1:
+					r.Value().broken.Store(true)
+					r.Release()
+				default:
+					r.Release()
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	s := p.Stats()
+	if s.InUse != 0 || s.Open != s.Idle || s.Open > 3 {
+		t.Fatalf("stats = %+v", s)
+	}
+	if live := d.opened.Load() - d.closed.Load(); int(live) != s.Open {
+		t.Fatalf("opened - closed = %d, Open = %d", live, s.Open)
+	}
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := p.Acquire(ctx); err != nil {
+			t.Fatalf("第 %d 个名额丢了: %v", i+1, err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,94 @@
+// Package syncx 补充标准库 sync 中缺少的同步原语：可以取消的条件变量、失败后可以重试的 Once、
+// 能检查加锁顺序、可以超时放弃的互斥锁，按键加锁的 KeyedMutex 和 StripedMutex 等。
+package syncx
+
+import (
+	"context"
+	"sync"
+)
+
+// Cond 是可以被 context 取消的条件变量，用法与 sync.Cond 相同：
+// 持有 L 时检查条件，不满足就 Wait，条件改变后 Signal 或 Broadcast。
+//
+// 与 sync.Cond 不同，等待者在 ctx 结束时返回，不会因为没人通知而永远阻塞；
+// Signal 的唤醒也不会丢失：如果被 Signal 选中的等待者恰好同时被取消，它照常返回 nil，
+// 这次唤醒仍然算数，调用方应当像被唤醒一样重新检查条件。
+type Cond struct {
+	L sync.Locker
+
+	mu      sync.Mutex
+	waiters []chan struct{} // 按开始等待的顺序，Signal 唤醒最早的一个
+}
+
+// NewCond 创建一个以 l 为锁的 Cond。
+func NewCond(l sync.Locker) *Cond {
+	return &Cond{L: l}
+}
+
+// Wait 等价于 WaitCtx(context.Background())。
+func (c *Cond) Wait() {
+	c.WaitCtx(context.Background())
+}
+
+// WaitCtx 原子地释放 c.L 并挂起，直到被 Signal/Broadcast 唤醒或 ctx 结束，返回前重新获取 c.L。
+// 调用时必须持有 c.L。被唤醒返回 nil，因 ctx 结束返回 ctx.Err()。
+func (c *Cond) WaitCtx(ctx context.Context) error {
+	// 在释放 L 之前登记，释放之后才发生的 Signal 一定能看到这个等待者
+	ch := make(chan struct{})
+	c.mu.Lock()
+	c.waiters = append(c.waiters, ch)
+	c.mu.Unlock()
+
+	c.L.Unlock()
+	defer c.L.Lock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		if w == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// 已经被 Signal 从队列中取走，这次唤醒属于我们
+	return nil
+}
+
+// WaitUntil 在 pred 返回 true 之前反复等待，调用时和返回时都持有 c.L，pred 也在持有 c.L 时调用。
+// 条件满足返回 nil，ctx 先结束返回 ctx.Err()。
+func (c *Cond) WaitUntil(ctx context.Context, pred func() bool) error {
+	for !pred() {
+		if err := c.WaitCtx(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Signal 唤醒等待最久的一个等待者，没有等待者时什么也不做。调用时可以不持有 c.L。
+func (c *Cond) Signal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return
+	}
+	close(c.waiters[0])
+	c.waiters[0] = nil
+	c.waiters = c.waiters[1:]
+}
+
+// Broadcast 唤醒所有等待者。调用时可以不持有 c.L。
+func (c *Cond) Broadcast() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ch := range c.waiters {
+		close(ch)
+	}
+	c.waiters = nil
+}
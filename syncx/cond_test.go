@@ -0,0 +1,252 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 与 TestCond 相同的订阅场景，但订阅者在没有人 Broadcast 时会随 ctx 退出而不是泄漏
+func TestCondSubscribersDoNotLeak(t *testing.T) {
+	c := NewCond(&sync.Mutex{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.L.Lock()
+			defer c.L.Unlock()
+			errs <- c.WaitCtx(ctx)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want DeadlineExceeded", err)
+		}
+	}
+}
+
+func TestCondBroadcast(t *testing.T) {
+	var mu sync.Mutex
+	c := NewCond(&mu)
+	clicked := false
+
+	var wg sync.WaitGroup
+	var woken atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			if err := c.WaitUntil(context.Background(), func() bool { return clicked }); err != nil {
+				t.Error(err)
+			}
+			woken.Add(1)
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	clicked = true
+	mu.Unlock()
+	c.Broadcast()
+	wg.Wait()
+	if woken.Load() != 10 {
+		t.Fatalf("woken = %d", woken.Load())
+	}
+}
+
+func TestCondSignalWakesOne(t *testing.T) {
+	var mu sync.Mutex
+	c := NewCond(&mu)
+
+	var woken atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			if c.WaitCtx(ctx) == nil {
+				woken.Add(1)
+			}
+		}()
+	}
+	waitForWaiters(t, c, 3)
+
+	c.Signal()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	if woken.Load() != 1 {
+		t.Fatalf("Signal 唤醒了 %d 个等待者, want 1", woken.Load())
+	}
+}
+
+// 被取消的等待者返回时持有锁，并且从等待队列中移除
+func TestCondCancelHoldsLock(t *testing.T) {
+	var mu sync.Mutex
+	c := NewCond(&mu)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mu.Lock()
+	if err := c.WaitCtx(ctx); err != context.Canceled {
+		t.Fatalf("err = %v", err)
+	}
+	if mu.TryLock() {
+		t.Fatal("WaitCtx 返回时应该持有锁")
+	}
+	mu.Unlock()
+	if n := len(c.waiters); n != 0 {
+		t.Fatalf("取消后还有 %d 个等待者", n)
+	}
+}
+
+func waitForWaiters(t *testing.T, c *Cond, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		got := len(c.waiters)
+		c.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("等待者 %d 个, want %d", got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 大量等待者随机取消的同时生产者不断 Signal，每生产一个单位只 Signal 一次。
+// 短命的等待者只等一次，超时就退出；如果落在它们身上的唤醒丢了，
+// 剩下的单位就没有人被唤醒，常驻的消费者会一直睡下去，测试超时失败。
+func TestCondNoLostWakeups(t *testing.T) {
+	var mu sync.Mutex
+	c := NewCond(&mu)
+	available := 0
+	stopped := false
+	ready := func() bool { return available > 0 || stopped }
+
+	const producers, perProducer = 4, 500
+	const total = producers * perProducer
+	var consumed atomic.Int32
+	consume := func() {
+		if available > 0 {
+			available--
+			consumed.Add(1)
+		}
+	}
+
+	var steady sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		steady.Add(1)
+		go func() {
+			defer steady.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				c.WaitUntil(context.Background(), ready)
+				if stopped {
+					return
+				}
+				consume()
+			}
+		}()
+	}
+
+	var transient sync.WaitGroup
+	for i := 0; i < 400; i++ {
+		transient.Add(1)
+		go func(seed int64) {
+			defer transient.Done()
+			rng := rand.New(rand.NewSource(seed))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rng.Intn(500))*time.Microsecond)
+			defer cancel()
+			mu.Lock()
+			defer mu.Unlock()
+			if c.WaitUntil(ctx, ready) == nil {
+				consume()
+			}
+		}(int64(i))
+	}
+
+	var producersWG sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		producersWG.Add(1)
+		go func() {
+			defer producersWG.Done()
+			for j := 0; j < perProducer; j++ {
+				mu.Lock()
+				available++
+				mu.Unlock()
+				c.Signal()
+			}
+		}()
+	}
+	producersWG.Wait()
+	transient.Wait()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for consumed.Load() != total {
+		if time.Now().After(deadline) {
+			t.Fatalf("consumed = %d, want %d, 有唤醒丢失", consumed.Load(), total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+	c.Broadcast()
+	steady.Wait()
+}
+
+// hookLocker 在 Unlock 时执行一次 hook，用来在 WaitCtx 登记之后、进入 select 之前插入操作。
+type hookLocker struct {
+	sync.Mutex
+	hook func()
+}
+
+func (l *hookLocker) Unlock() {
+	if h := l.hook; h != nil {
+		l.hook = nil
+		h()
+	}
+	l.Mutex.Unlock()
+}
+
+// 等待者被 Signal 选中时 ctx 也已经结束，select 会随机选一个分支；
+// 无论选了哪个，WaitCtx 都必须返回 nil，否则这次唤醒就丢了
+func TestCondSignalThenCancel(t *testing.T) {
+	for round := 0; round < 200; round++ {
+		l := &hookLocker{}
+		c := NewCond(l)
+		ctx, cancel := context.WithCancel(context.Background())
+		l.hook = func() {
+			c.Signal()
+			cancel()
+		}
+
+		l.Lock()
+		err := c.WaitCtx(ctx)
+		l.Unlock()
+		if err != nil {
+			t.Fatalf("第 %d 轮: 已被 Signal 的等待者返回 %v", round, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package syncx
+
+import (
+	"hash/maphash"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"review/internal/keyhash"
+)
+
+// KeyedMutex 按键加锁：同一个键上的 Lock 互斥，不同键互不阻塞，例如按实体 ID 串行化操作。
+// 每个键的锁在第一次用到时创建，没有人持有或等待时回收，所以键的数量可以没有上限。零值可用。
+//
+// 键与 cmap.ConcurrentMap 的键类型约束相同，可以直接用 map 的键串行化对同一条目的读-改-写，
+// 而不必锁住整个分片。
+type KeyedMutex[K comparable] struct {
+	locks keyedLocks[K, sync.Mutex]
+}
+
+// Lock 锁住键 k。
+func (km *KeyedMutex[K]) Lock(k K) {
+	km.locks.ref(k).Lock()
+}
+
+// TryLock 尝试锁住键 k，不等待。
+func (km *KeyedMutex[K]) TryLock(k K) bool {
+	if km.locks.ref(k).TryLock() {
+		return true
+	}
+	km.locks.unref(k)
+	return false
+}
+
+// Unlock 解锁键 k。k 没有被锁住时 panic。
+func (km *KeyedMutex[K]) Unlock(k K) {
+	km.locks.unref(k).Unlock()
+}
+
+// Len 返回当前被持有或等待中的键的数量。
+func (km *KeyedMutex[K]) Len() int {
+	return km.locks.len()
+}
+
+// KeyedRWMutex 是按键加锁的读写锁，键的锁同样按需创建、用完回收。零值可用。
+type KeyedRWMutex[K comparable] struct {
+	locks keyedLocks[K, sync.RWMutex]
+}
+
+// Lock 以写方式锁住键 k。
+func (km *KeyedRWMutex[K]) Lock(k K) {
+	km.locks.ref(k).Lock()
+}
+
+// TryLock 尝试以写方式锁住键 k，不等待。
+func (km *KeyedRWMutex[K]) TryLock(k K) bool {
+	if km.locks.ref(k).TryLock() {
+		return true
+	}
+	km.locks.unref(k)
+	return false
+}
+
+// Unlock 释放键 k 的写锁。
+func (km *KeyedRWMutex[K]) Unlock(k K) {
+	km.locks.unref(k).Unlock()
+}
+
+// RLock 以读方式锁住键 k。
+func (km *KeyedRWMutex[K]) RLock(k K) {
+	km.locks.ref(k).RLock()
+}
+
+// TryRLock 尝试以读方式锁住键 k，不等待。
+func (km *KeyedRWMutex[K]) TryRLock(k K) bool {
+	if km.locks.ref(k).TryRLock() {
+		return true
+	}
+	km.locks.unref(k)
+	return false
+}
+
+// RUnlock 释放键 k 的读锁。
+func (km *KeyedRWMutex[K]) RUnlock(k K) {
+	km.locks.unref(k).RUnlock()
+}
+
+// Len 返回当前被持有或等待中的键的数量。
+func (km *KeyedRWMutex[K]) Len() int {
+	return km.locks.len()
+}
+
+// keyedLocks 为每个键维护一把带引用计数的锁。引用计数包括持有者和等待者，
+// 降到零时条目被删除，下次用到时重新创建。
+type keyedLocks[K comparable, L any] struct {
+	mu      sync.Mutex
+	entries map[K]*keyedEntry[L]
+}
+
+type keyedEntry[L any] struct {
+	lock L
+	refs int
+}
+
+func (kl *keyedLocks[K, L]) ref(k K) *L {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.entries == nil {
+		kl.entries = make(map[K]*keyedEntry[L])
+	}
+	e, ok := kl.entries[k]
+	if !ok {
+		e = &keyedEntry[L]{}
+		kl.entries[k] = e
+	}
+	e.refs++
+	return &e.lock
+}
+
+func (kl *keyedLocks[K, L]) unref(k K) *L {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	e, ok := kl.entries[k]
+	if !ok {
+		panic("syncx: 解锁了没有锁住的键")
+	}
+	if e.refs--; e.refs == 0 {
+		delete(kl.entries, k)
+	}
+	return &e.lock
+}
+
+func (kl *keyedLocks[K, L]) len() int {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	return len(kl.entries)
+}
+
+const (
+	defaultStripes = 256
+	cacheLineSize  = 64
+)
+
+// StripedMutex 把键按哈希映射到固定数量的读写锁上。与 KeyedMutex 相比它不分配也不回收，
+// 适合热点路径；代价是不同的键可能落在同一把锁上而互相阻塞。
+// 键的哈希方式与 cmap.ConcurrentMap 分片相同。
+//
+// 同时锁多个键要用 LockMany，它按固定顺序加锁，逐个调用 Lock 可能因为顺序相反而死锁。
+type StripedMutex[K comparable] struct {
+	seed    maphash.Seed
+	mask    uint64
+	stripes []stripe
+}
+
+// stripe 凑满一个缓存行，避免相邻的锁伪共享。
+type stripe struct {
+	sync.RWMutex
+	_ [cacheLineSize - unsafe.Sizeof(sync.RWMutex{})%cacheLineSize]byte
+}
+
+// NewStripedMutex 创建有 n 把锁的 StripedMutex，n 向上取到 2 的幂，<= 0 时用 256。
+func NewStripedMutex[K comparable](n int) *StripedMutex[K] {
+	if n <= 0 {
+		n = defaultStripes
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	return &StripedMutex[K]{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(size - 1),
+		stripes: make([]stripe, size),
+	}
+}
+
+func (sm *StripedMutex[K]) index(k K) int {
+	return int(keyhash.Hash(sm.seed, k) & sm.mask)
+}
+
+// Lock 以写方式锁住 k 所在的锁。
+func (sm *StripedMutex[K]) Lock(k K) {
+	sm.stripes[sm.index(k)].Lock()
+}
+
+// Unlock 释放 k 所在的写锁。
+func (sm *StripedMutex[K]) Unlock(k K) {
+	sm.stripes[sm.index(k)].Unlock()
+}
+
+// RLock 以读方式锁住 k 所在的锁。
+func (sm *StripedMutex[K]) RLock(k K) {
+	sm.stripes[sm.index(k)].RLock()
+}
+
+// RUnlock 释放 k 所在的读锁。
+func (sm *StripedMutex[K]) RUnlock(k K) {
+	sm.stripes[sm.index(k)].RUnlock()
+}
+
+// LockMany 以写方式锁住所有键所在的锁，按锁的下标顺序加锁，落在同一把锁上的键只锁一次。
+// 返回的函数释放这些锁。
+func (sm *StripedMutex[K]) LockMany(keys ...K) (unlock func()) {
+	idx := make([]int, 0, len(keys))
+	for _, k := range keys {
+		idx = append(idx, sm.index(k))
+	}
+	sort.Ints(idx)
+	n := 0
+	for i, x := range idx {
+		if i == 0 || x != idx[n-1] {
+			idx[n] = x
+			n++
+		}
+	}
+	idx = idx[:n]
+
+	for _, i := range idx {
+		sm.stripes[i].Lock()
+	}
+	return func() {
+		for j := len(idx) - 1; j >= 0; j-- {
+			sm.stripes[idx[j]].Unlock()
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package syncx
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"review/cmap"
+)
+
+func TestKeyedMutexPerKey(t *testing.T) {
+	var km KeyedMutex[int]
+	km.Lock(1)
+	if km.TryLock(1) {
+		t.Fatal("同一个键应该互斥")
+	}
+	if !km.TryLock(2) {
+		t.Fatal("不同的键不应该互相阻塞")
+	}
+	km.Unlock(2)
+	km.Unlock(1)
+	if km.Len() != 0 {
+		t.Fatalf("Len = %d, 解锁后条目应该被回收", km.Len())
+	}
+}
+
+// 等待者也持有引用，持有者解锁时条目不会被提前回收
+func TestKeyedMutexWaiterKeepsEntry(t *testing.T) {
+	var km KeyedMutex[string]
+	km.Lock("a")
+
+	locked := make(chan struct{})
+	go func() {
+		km.Lock("a")
+		close(locked)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for km.refs("a") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("等待者没有登记引用")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	km.Unlock("a")
+	<-locked
+	if km.Len() != 1 {
+		t.Fatalf("Len = %d, 等待者拿到锁后条目应该还在", km.Len())
+	}
+	km.Unlock("a")
+	if km.Len() != 0 {
+		t.Fatalf("Len = %d", km.Len())
+	}
+}
+
+func (km *KeyedMutex[K]) refs(k K) int {
+	km.locks.mu.Lock()
+	defer km.locks.mu.Unlock()
+	return km.locks.entries[k].refs
+}
+
+func TestKeyedMutexUnlockUnlocked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("解锁没有锁住的键应该 panic")
+		}
+	}()
+	var km KeyedMutex[int]
+	km.Unlock(1)
+}
+
+func TestKeyedRWMutex(t *testing.T) {
+	var km KeyedRWMutex[string]
+	km.RLock("a")
+	if !km.TryRLock("a") {
+		t.Fatal("读锁之间不应该互斥")
+	}
+	if km.TryLock("a") {
+		t.Fatal("有读者时不应该拿到写锁")
+	}
+	if !km.TryLock("b") {
+		t.Fatal("不同的键不应该互相阻塞")
+	}
+	km.Unlock("b")
+	km.RUnlock("a")
+	km.RUnlock("a")
+	if !km.TryLock("a") {
+		t.Fatal("读者都走了之后应该拿到写锁")
+	}
+	if km.TryRLock("a") {
+		t.Fatal("有写者时不应该拿到读锁")
+	}
+	km.Unlock("a")
+	if km.Len() != 0 {
+		t.Fatalf("Len = %d", km.Len())
+	}
+}
+
+// 对 ConcurrentMap 中同一个账户的读-改-写按键串行化，中间可以做慢操作而不锁住整个分片
+func TestKeyedMutexWithConcurrentMap(t *testing.T) {
+	balances := cmap.New[string, int]()
+	var km KeyedMutex[string]
+
+	const accounts, deposits = 5, 200
+	var wg sync.WaitGroup
+	for i := 0; i < accounts*deposits; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprint("acct-", i%accounts)
+			km.Lock(id)
+			defer km.Unlock(id)
+			v, _ := balances.Get(id)
+			time.Sleep(time.Microsecond) // 模拟读写之间的外部调用
+			balances.Put(id, v+1)
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < accounts; i++ {
+		if v, _ := balances.Get(fmt.Sprint("acct-", i)); v != deposits {
+			t.Fatalf("acct-%d = %d, want %d", i, v, deposits)
+		}
+	}
+	if km.Len() != 0 {
+		t.Fatalf("Len = %d, 条目没有回收", km.Len())
+	}
+}
+
+func TestStripedMutexStripes(t *testing.T) {
+	if n := len(NewStripedMutex[int](100).stripes); n != 128 {
+		t.Fatalf("stripes = %d, want 128", n)
+	}
+	if n := len(NewStripedMutex[int](0).stripes); n != defaultStripes {
+		t.Fatalf("stripes = %d, want %d", n, defaultStripes)
+	}
+
+	sm := NewStripedMutex[float64](16)
+	if sm.index(0) != sm.index(math.Copysign(0, -1)) {
+		t.Fatal("+0 和 -0 是同一个键，应该落在同一把锁上")
+	}
+
+	sm.Lock(1)
+	sm.Unlock(1)
+	sm.RLock(1)
+	sm.RLock(1)
+	sm.RUnlock(1)
+	sm.RUnlock(1)
+}
+
+// 指针键按身份映射：持有期间修改所指向的内容，Unlock 仍然释放 Lock 时的那把锁
+func TestStripedMutexPointerKeys(t *testing.T) {
+	type account struct{ balance int }
+	sm := NewStripedMutex[*account](64)
+	var km KeyedMutex[*account]
+
+	for i := 0; i < 100; i++ {
+		a := &account{balance: i}
+		idx := sm.index(a)
+		sm.Lock(a)
+		km.Lock(a)
+		a.balance += 1000
+		if sm.index(a) != idx {
+			t.Fatalf("修改内容后键落到了另一把锁上")
+		}
+		km.Unlock(a)
+		sm.Unlock(a)
+		if !sm.stripes[idx].TryLock() {
+			t.Fatal("Unlock 之后原来的锁应该已经释放")
+		}
+		sm.stripes[idx].Unlock()
+	}
+	if km.Len() != 0 {
+		t.Fatalf("Len = %d", km.Len())
+	}
+}
+
+// 随机账户之间转账：每次锁住两个账户，顺序不一致时逐个 Lock 会死锁，LockMany 不会
+func TestStripedMutexLockMany(t *testing.T) {
+	balances := cmap.New[int, int]()
+	const accounts = 50
+	for i := 0; i < accounts; i++ {
+		balances.Put(i, 100)
+	}
+	sm := NewStripedMutex[int](8)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for j := 0; j < 500; j++ {
+				from, to := rng.Intn(accounts), rng.Intn(accounts)
+				unlock := sm.LockMany(from, to)
+				a, _ := balances.Get(from)
+				balances.Put(from, a-1)
+				b, _ := balances.Get(to)
+				balances.Put(to, b+1)
+				unlock()
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	total := 0
+	balances.Range(func(_ int, v int) bool {
+		total += v
+		return true
+	})
+	if total != accounts*100 {
+		t.Fatalf("总额 = %d, want %d", total, accounts*100)
+	}
+
+	// 落在同一把锁上的键只锁一次，否则会自己把自己锁死
+	unlock := sm.LockMany(1, 1, 1)
+	unlock()
+}
@@ -0,0 +1,6 @@
+//go:build !lockdebug
+
+package syncx
+
+// lockDebug 为 true 时 Mutex 和 RWMutex 记录加锁顺序。
+const lockDebug = false
@@ -0,0 +1,73 @@
+//go:build lockdebug
+
+package syncx
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 用 Mutex 重写 TestDeadLock 的 printSum：两个 goroutine 先后执行，没有真的死锁，但加锁顺序相反
+func TestLockDebugDetectsInversion(t *testing.T) {
+	var mu sync.Mutex
+	var cycles []LockCycle
+	SetLockOrderHandler(func(c LockCycle) {
+		mu.Lock()
+		defer mu.Unlock()
+		cycles = append(cycles, c)
+	})
+	defer SetLockOrderHandler(nil)
+
+	type value struct {
+		mu    Mutex
+		value int
+	}
+	printSum := func(v1, v2 *value) int {
+		v1.mu.Lock()
+		defer v1.mu.Unlock()
+		v2.mu.Lock()
+		defer v2.mu.Unlock()
+		return v1.value + v2.value
+	}
+
+	var a, b value
+	for _, args := range [][2]*value{{&a, &b}, {&b, &a}} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			printSum(args[0], args[1])
+		}()
+		<-done
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(cycles) != 1 {
+		t.Fatalf("报告了 %d 次, want 1", len(cycles))
+	}
+	if s := cycles[0].String(); strings.Count(s, "TestLockDebugDetectsInversion") < 4 {
+		t.Fatalf("报告中应该包含两次加锁各自的调用栈:\n%s", s)
+	}
+}
+
+func TestLockDebugRWMutex(t *testing.T) {
+	var cycles []LockCycle
+	SetLockOrderHandler(func(c LockCycle) { cycles = append(cycles, c) })
+	defer SetLockOrderHandler(nil)
+
+	var a RWMutex
+	var b Mutex
+	a.RLock()
+	b.Lock()
+	b.Unlock()
+	a.RUnlock()
+
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+	if len(cycles) != 1 {
+		t.Fatalf("读锁也应该参与加锁顺序, 报告了 %d 次", len(cycles))
+	}
+}
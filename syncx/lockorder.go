@@ -0,0 +1,240 @@
+package syncx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LockEdge 是加锁顺序图中的一条边：某个 goroutine 持有 From 时获取了 To。
+// Held 和 Acquired 分别是第一次出现这个顺序时获取两把锁的调用栈。
+type LockEdge struct {
+	From, To uint64
+	Held     string
+	Acquired string
+}
+
+// LockCycle 是加锁顺序图中的一个环，按顺序首尾相接，最后一条边是刚刚观察到的那次加锁。
+// 环说明这些锁没有统一的加锁顺序，只要时机不巧就会死锁，即使这一次运行并没有真的死锁。
+type LockCycle []LockEdge
+
+func (c LockCycle) String() string {
+	var b strings.Builder
+	b.WriteString("syncx: 加锁顺序成环，可能死锁:\n")
+	for _, e := range c {
+		fmt.Fprintf(&b, "\nlock#%d -> lock#%d\n  持有 lock#%d 于:\n%s  获取 lock#%d 于:\n%s",
+			e.From, e.To, e.From, indent(e.Held), e.To, indent(e.Acquired))
+	}
+	return b.String()
+}
+
+func indent(s string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" {
+			b.WriteString("    ")
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// SetLockOrderHandler 设置发现加锁顺序成环时的回调，nil 表示恢复默认行为：打印到标准错误。
+// 只有用 lockdebug 构建标签编译时 Mutex 和 RWMutex 才会记录加锁顺序。
+func SetLockOrderHandler(fn func(LockCycle)) {
+	lockOrderGraph.setReport(fn)
+}
+
+func defaultLockOrderReport(c LockCycle) {
+	fmt.Fprintln(os.Stderr, c)
+}
+
+var lockOrderGraph = newLockOrder()
+
+// lockID 在第一次加锁时分配，不用锁的地址做标识，避免地址被复用后把不相干的锁当成同一把。
+type lockID struct {
+	v atomic.Uint64
+}
+
+var nextLockID atomic.Uint64
+
+func (id *lockID) get() uint64 {
+	if v := id.v.Load(); v != 0 {
+		return v
+	}
+	id.v.CompareAndSwap(0, nextLockID.Add(1))
+	return id.v.Load()
+}
+
+// lockOrder 记录全局的加锁顺序图和每个 goroutine 当前持有的锁。
+type lockOrder struct {
+	mu     sync.Mutex
+	edges  map[uint64]map[uint64]*lockEdge
+	held   map[int64][]heldLock // goroutine id -> 按获取顺序持有的锁
+	report func(LockCycle)
+}
+
+type lockEdge struct {
+	held, acquired []uintptr
+}
+
+type heldLock struct {
+	id    uint64
+	stack []uintptr
+}
+
+func newLockOrder() *lockOrder {
+	return &lockOrder{
+		edges:  make(map[uint64]map[uint64]*lockEdge),
+		held:   make(map[int64][]heldLock),
+		report: defaultLockOrderReport,
+	}
+}
+
+func (o *lockOrder) setReport(fn func(LockCycle)) {
+	if fn == nil {
+		fn = defaultLockOrderReport
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.report = fn
+}
+
+// acquire 记录 goroutine g 获取了锁 id。blocking 为 false 表示 TryLock 成功：
+// 它不会等待，所以不会参与死锁，只记为持有，不从已持有的锁向它连边。
+// 在真正阻塞之前调用，这样即使这次真的死锁了也能先报告出来。
+func (o *lockOrder) acquire(g int64, id uint64, stack []uintptr, blocking bool) {
+	var cycles []LockCycle
+
+	o.mu.Lock()
+	if blocking {
+		for _, h := range o.held[g] {
+			if h.id == id || o.edges[h.id][id] != nil {
+				continue
+			}
+			// 新边 h -> id 与已有的 id -> ... -> h 成环
+			path := o.path(id, h.id)
+			if o.edges[h.id] == nil {
+				o.edges[h.id] = make(map[uint64]*lockEdge)
+			}
+			o.edges[h.id][id] = &lockEdge{held: h.stack, acquired: stack}
+			if path != nil {
+				cycles = append(cycles, o.cycle(append(path, id)))
+			}
+		}
+	}
+	o.held[g] = append(o.held[g], heldLock{id: id, stack: stack})
+	report := o.report
+	o.mu.Unlock()
+
+	for _, c := range cycles {
+		report(c)
+	}
+}
+
+// release 记录锁 id 被释放。Go 允许在别的 goroutine 中解锁，所以先找 g 自己持有的，找不到再找所有 goroutine。
+func (o *lockOrder) release(g int64, id uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drop(g, id) {
+		return
+	}
+	for other := range o.held {
+		if o.drop(other, id) {
+			return
+		}
+	}
+}
+
+func (o *lockOrder) drop(g int64, id uint64) bool {
+	held := o.held[g]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i].id == id {
+			held = append(held[:i], held[i+1:]...)
+			if len(held) == 0 {
+				delete(o.held, g)
+			} else {
+				o.held[g] = held
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// path 返回图中从 from 到 to 的一条路径（包含两端），不存在时返回 nil。调用时必须持有 o.mu。
+func (o *lockOrder) path(from, to uint64) []uint64 {
+	prev := map[uint64]uint64{from: from}
+	queue := []uint64{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			var path []uint64
+			for n := to; n != from; n = prev[n] {
+				path = append(path, n)
+			}
+			path = append(path, from)
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+		for next := range o.edges[cur] {
+			if _, ok := prev[next]; !ok {
+				prev[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// cycle 把形如 [a, b, ..., a] 的节点序列转成边的列表。调用时必须持有 o.mu。
+func (o *lockOrder) cycle(nodes []uint64) LockCycle {
+	var c LockCycle
+	for i := 0; i+1 < len(nodes); i++ {
+		e := o.edges[nodes[i]][nodes[i+1]]
+		c = append(c, LockEdge{From: nodes[i], To: nodes[i+1], Held: formatStack(e.held), Acquired: formatStack(e.acquired)})
+	}
+	return c
+}
+
+// callers 记录加锁位置的调用栈，跳过 syncx 自己的帧。
+func callers() []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+func formatStack(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
+
+// goid 从调用栈的第一行解析当前 goroutine 的 id，开销不小，只在 lockdebug 下使用。
+func goid() int64 {
+	var buf [64]byte
+	s := buf[:runtime.Stack(buf[:], false)]
+	s = bytes.TrimPrefix(s, []byte("goroutine "))
+	if i := bytes.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	id, _ := strconv.ParseInt(string(s), 10, 64)
+	return id
+}
@@ -0,0 +1,139 @@
+package syncx
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordCycles 返回一个只记录报告的加锁顺序图
+func recordCycles() (*lockOrder, *[]LockCycle) {
+	var cycles []LockCycle
+	o := newLockOrder()
+	o.setReport(func(c LockCycle) { cycles = append(cycles, c) })
+	return o, &cycles
+}
+
+func lockAt() []uintptr { return callers() }
+
+// TestDeadLock 的加锁顺序：一个 goroutine 先 a 后 b，另一个先 b 后 a。
+// 即使两次加锁前后错开、没有真的死锁，第二个顺序一出现就报告
+func TestLockOrderInversion(t *testing.T) {
+	o, cycles := recordCycles()
+	const a, b = 1, 2
+
+	o.acquire(1, a, lockAt(), true)
+	o.acquire(1, b, lockAt(), true)
+	o.release(1, b)
+	o.release(1, a)
+	if len(*cycles) != 0 {
+		t.Fatalf("一致的顺序不应该报告: %v", *cycles)
+	}
+
+	o.acquire(2, b, lockAt(), true)
+	o.acquire(2, a, lockAt(), true)
+	if len(*cycles) != 1 {
+		t.Fatalf("报告了 %d 次, want 1", len(*cycles))
+	}
+	c := (*cycles)[0]
+	if len(c) != 2 || c[0].From != a || c[0].To != b || c[1].From != b || c[1].To != a {
+		t.Fatalf("cycle = %+v", c)
+	}
+	for _, e := range c {
+		if !strings.Contains(e.Held, "TestLockOrderInversion") || !strings.Contains(e.Acquired, "TestLockOrderInversion") {
+			t.Fatalf("边 %d -> %d 缺少调用栈:\n%s", e.From, e.To, c)
+		}
+	}
+	o.release(2, a)
+	o.release(2, b)
+
+	// 同一个环只报告一次
+	o.acquire(3, b, lockAt(), true)
+	o.acquire(3, a, lockAt(), true)
+	if len(*cycles) != 1 {
+		t.Fatalf("重复报告了同一个环")
+	}
+}
+
+func TestLockOrderLongCycle(t *testing.T) {
+	o, cycles := recordCycles()
+	for _, pair := range [][2]uint64{{1, 2}, {2, 3}, {3, 4}} {
+		o.acquire(1, pair[0], nil, true)
+		o.acquire(1, pair[1], nil, true)
+		o.release(1, pair[1])
+		o.release(1, pair[0])
+	}
+	o.acquire(2, 4, nil, true)
+	o.acquire(2, 1, nil, true)
+
+	if len(*cycles) != 1 {
+		t.Fatalf("报告了 %d 次, want 1", len(*cycles))
+	}
+	var got []uint64
+	for _, e := range (*cycles)[0] {
+		got = append(got, e.From)
+	}
+	if want := []uint64{1, 2, 3, 4}; !equalIDs(got, want) {
+		t.Fatalf("环 = %v, want %v", got, want)
+	}
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TryLock 不会阻塞，持有别的锁时 TryLock 成功不算一个加锁顺序
+func TestLockOrderTryLock(t *testing.T) {
+	o, cycles := recordCycles()
+	o.acquire(1, 1, nil, true)
+	o.acquire(1, 2, nil, false)
+	o.release(1, 2)
+	o.release(1, 1)
+
+	o.acquire(2, 2, nil, true)
+	o.acquire(2, 1, nil, true)
+	if len(*cycles) != 0 {
+		t.Fatalf("TryLock 不应该引起报告: %v", *cycles)
+	}
+}
+
+// 在别的 goroutine 中解锁之后，原来的 goroutine 不再被当作持有者
+func TestLockOrderUnlockElsewhere(t *testing.T) {
+	o, cycles := recordCycles()
+	o.acquire(1, 1, nil, true)
+	o.release(2, 1)
+
+	o.acquire(1, 2, nil, true)
+	o.release(1, 2)
+	o.acquire(1, 2, nil, true)
+	o.acquire(1, 1, nil, true)
+	if len(*cycles) != 0 {
+		t.Fatalf("已经释放的锁不应该连边: %v", *cycles)
+	}
+	if len(o.held[2]) != 0 {
+		t.Fatalf("held = %v", o.held)
+	}
+}
+
+func TestGoid(t *testing.T) {
+	ids := make(chan int64, 2)
+	ids <- goid()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ids <- goid()
+	}()
+	wg.Wait()
+	if a, b := <-ids, <-ids; a == 0 || b == 0 || a == b {
+		t.Fatalf("goid = %d, %d", a, b)
+	}
+}
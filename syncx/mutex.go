@@ -0,0 +1,100 @@
+package syncx
+
+import "sync"
+
+// Mutex 可以直接替换 sync.Mutex。用 lockdebug 构建标签编译时，它把加锁顺序记入全局的加锁顺序图，
+// 第一次观察到与已有顺序相反的加锁时就报告可能的死锁，见 SetLockOrderHandler；
+// 不带标签时只是 sync.Mutex 的简单包装，没有额外开销。零值可用。
+type Mutex struct {
+	mu sync.Mutex
+	id lockID
+}
+
+func (m *Mutex) Lock() {
+	if lockDebug {
+		lockOrderGraph.acquire(goid(), m.id.get(), callers(), true)
+	}
+	m.mu.Lock()
+}
+
+func (m *Mutex) TryLock() bool {
+	if !m.mu.TryLock() {
+		return false
+	}
+	if lockDebug {
+		lockOrderGraph.acquire(goid(), m.id.get(), callers(), false)
+	}
+	return true
+}
+
+func (m *Mutex) Unlock() {
+	if lockDebug {
+		lockOrderGraph.release(goid(), m.id.get())
+	}
+	m.mu.Unlock()
+}
+
+// RWMutex 可以直接替换 sync.RWMutex，lockdebug 下的行为与 Mutex 相同。
+// 读锁与写锁一样参与加锁顺序：读锁在有写者排队时同样会阻塞，相反的顺序同样可能死锁。零值可用。
+type RWMutex struct {
+	mu sync.RWMutex
+	id lockID
+}
+
+func (rw *RWMutex) Lock() {
+	if lockDebug {
+		lockOrderGraph.acquire(goid(), rw.id.get(), callers(), true)
+	}
+	rw.mu.Lock()
+}
+
+func (rw *RWMutex) TryLock() bool {
+	if !rw.mu.TryLock() {
+		return false
+	}
+	if lockDebug {
+		lockOrderGraph.acquire(goid(), rw.id.get(), callers(), false)
+	}
+	return true
+}
+
+func (rw *RWMutex) Unlock() {
+	if lockDebug {
+		lockOrderGraph.release(goid(), rw.id.get())
+	}
+	rw.mu.Unlock()
+}
+
+func (rw *RWMutex) RLock() {
+	if lockDebug {
+		lockOrderGraph.acquire(goid(), rw.id.get(), callers(), true)
+	}
+	rw.mu.RLock()
+}
+
+func (rw *RWMutex) TryRLock() bool {
+	if !rw.mu.TryRLock() {
+		return false
+	}
+	if lockDebug {
+		lockOrderGraph.acquire(goid(), rw.id.get(), callers(), false)
+	}
+	return true
+}
+
+func (rw *RWMutex) RUnlock() {
+	if lockDebug {
+		lockOrderGraph.release(goid(), rw.id.get())
+	}
+	rw.mu.RUnlock()
+}
+
+// RLocker 返回一个用 RLock/RUnlock 实现 Lock/Unlock 的 sync.Locker。
+func (rw *RWMutex) RLocker() sync.Locker {
+	return (*rlocker)(rw)
+}
+
+type rlocker RWMutex
+
+func (r *rlocker) Lock()   { (*RWMutex)(r).RLock() }
+func (r *rlocker) Unlock() { (*RWMutex)(r).RUnlock() }
@@ -0,0 +1,47 @@
+package syncx
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMutexExcludes(t *testing.T) {
+	var mu Mutex
+	var rw RWMutex
+	count := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			count++
+			mu.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			rw.Lock()
+			rw.Unlock()
+			rw.RLocker().Lock()
+			rw.RLocker().Unlock()
+		}()
+	}
+	wg.Wait()
+	if count != 50 {
+		t.Fatalf("count = %d", count)
+	}
+
+	mu.Lock()
+	if mu.TryLock() {
+		t.Fatal("已经锁住时 TryLock 应该失败")
+	}
+	mu.Unlock()
+
+	rw.RLock()
+	if !rw.TryRLock() || rw.TryLock() {
+		t.Fatal("持有读锁时 TryRLock 应该成功、TryLock 应该失败")
+	}
+	rw.RUnlock()
+	rw.RUnlock()
+}
@@ -0,0 +1,159 @@
+package syncx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// OnceErr 与 sync.Once 类似，但只有 fn 成功（返回 nil）才算执行过：
+// 失败或 panic 之后，下一次 Do 会重新执行 fn。并发调用的 Do 串行执行。零值可用。
+type OnceErr struct {
+	mu   sync.Mutex
+	done atomic.Bool
+}
+
+// Do 在还没有成功执行过时调用 fn，返回 fn 的错误；已经成功过则直接返回 nil。
+func (o *OnceErr) Do(fn func() error) error {
+	if o.done.Load() {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done.Load() {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	o.done.Store(true)
+	return nil
+}
+
+// Reset 让下一次 Do 重新执行，主要用于测试。
+func (o *OnceErr) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.done.Store(false)
+}
+
+// OnceValue 只成功初始化一次值。同一时刻只有一个初始化在执行，并发的调用方共享它的结果；
+// 初始化失败不会被缓存，下一次调用重新初始化。零值可用。
+//
+// 每个调用方只按自己的 ctx 等待：ctx 结束时它立即返回 ctx.Err()，
+// 初始化本身不受影响，继续完成并交给其他等待者。
+type OnceValue[T any] struct {
+	mu   sync.Mutex
+	done bool
+	v    T
+	call *onceCall[T]
+}
+
+type onceCall[T any] struct {
+	done chan struct{}
+	v    T
+	err  error
+}
+
+// Do 返回已经初始化好的值，还没有时用 fn 初始化。fn 收到的 ctx 保留调用方 ctx 中的值但不会被取消。
+func (o *OnceValue[T]) Do(ctx context.Context, fn func(ctx context.Context) (T, error)) (T, error) {
+	o.mu.Lock()
+	if o.done {
+		v := o.v
+		o.mu.Unlock()
+		return v, nil
+	}
+	c := o.call
+	if c == nil {
+		c = &onceCall[T]{done: make(chan struct{})}
+		o.call = c
+		go o.run(context.WithoutCancel(ctx), c, fn)
+	}
+	o.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.v, c.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (o *OnceValue[T]) run(ctx context.Context, c *onceCall[T], fn func(ctx context.Context) (T, error)) {
+	c.v, c.err = callRecover(ctx, fn)
+
+	o.mu.Lock()
+	// Reset 之后开始的初始化才算数，之前的结果只交给当时的等待者
+	if o.call == c {
+		o.call = nil
+		if c.err == nil {
+			o.done, o.v = true, c.v
+		}
+	}
+	o.mu.Unlock()
+	close(c.done)
+}
+
+func callRecover[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) (v T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("syncx: 初始化 panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Reset 丢弃已初始化的值，下一次 Do 重新初始化。进行中的初始化照常把结果交给已经在等的调用方，但不会被保存。
+func (o *OnceValue[T]) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var zero T
+	o.done, o.v, o.call = false, zero, nil
+}
+
+// KeyedOnce 为每个键独立地做一次 OnceValue 式的初始化，例如每个租户一个数据库连接。
+// 不同键的初始化互不阻塞。零值可用。
+type KeyedOnce[K comparable, V any] struct {
+	mu    sync.Mutex
+	onces map[K]*OnceValue[V]
+}
+
+// Do 返回键 k 已经初始化好的值，还没有时用 fn 初始化，语义与 OnceValue.Do 相同。
+func (ko *KeyedOnce[K, V]) Do(ctx context.Context, k K, fn func(ctx context.Context, k K) (V, error)) (V, error) {
+	ko.mu.Lock()
+	if ko.onces == nil {
+		ko.onces = make(map[K]*OnceValue[V])
+	}
+	o, ok := ko.onces[k]
+	if !ok {
+		o = &OnceValue[V]{}
+		ko.onces[k] = o
+	}
+	ko.mu.Unlock()
+
+	return o.Do(ctx, func(ctx context.Context) (V, error) {
+		return fn(ctx, k)
+	})
+}
+
+// Forget 丢弃键 k 的值，下一次 Do 重新初始化，例如连接断开之后。
+func (ko *KeyedOnce[K, V]) Forget(k K) {
+	ko.mu.Lock()
+	defer ko.mu.Unlock()
+	if o, ok := ko.onces[k]; ok {
+		o.Reset()
+		delete(ko.onces, k)
+	}
+}
+
+// Reset 丢弃所有键的值。
+func (ko *KeyedOnce[K, V]) Reset() {
+	ko.mu.Lock()
+	defer ko.mu.Unlock()
+	for _, o := range ko.onces {
+		o.Reset()
+	}
+	ko.onces = nil
+}
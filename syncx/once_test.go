@@ -0,0 +1,213 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 与 TestOnce 不同，失败的初始化会在下一次调用时重试
+func TestOnceErrRetries(t *testing.T) {
+	var once OnceErr
+	var calls int
+	init := func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("not ready")
+		}
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := once.Do(init); err == nil {
+			t.Fatalf("第 %d 次应该失败", i+1)
+		}
+	}
+	if err := once.Do(init); err != nil {
+		t.Fatal(err)
+	}
+	once.Do(init)
+	if calls != 3 {
+		t.Fatalf("calls = %d, 成功后不应该再执行", calls)
+	}
+
+	once.Reset()
+	once.Do(init)
+	if calls != 4 {
+		t.Fatalf("Reset 后 calls = %d, want 4", calls)
+	}
+}
+
+func TestOnceErrConcurrent(t *testing.T) {
+	var once OnceErr
+	var count atomic.Int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			once.Do(func() error {
+				count.Add(1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if count.Load() != 1 {
+		t.Fatalf("count = %d, want 1", count.Load())
+	}
+}
+
+func TestOnceErrPanic(t *testing.T) {
+	var once OnceErr
+	func() {
+		defer func() { recover() }()
+		once.Do(func() error { panic("boom") })
+	}()
+	ran := false
+	once.Do(func() error { ran = true; return nil })
+	if !ran {
+		t.Fatal("panic 之后应该可以重试，锁也应该已经释放")
+	}
+}
+
+func TestOnceValueShared(t *testing.T) {
+	var once OnceValue[string]
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "conn", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := once.Do(context.Background(), fn); err != nil || v != "conn" {
+				t.Errorf("Do = %q, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("calls = %d, want 1", calls.Load())
+	}
+}
+
+// 等待者取消只影响自己，初始化继续完成并缓存
+func TestOnceValueCancelWaiter(t *testing.T) {
+	var once OnceValue[int]
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		<-release
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 42, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := once.Do(ctx, fn); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+
+	close(release)
+	v, err := once.Do(context.Background(), func(ctx context.Context) (int, error) {
+		t.Fatal("进行中的初始化应该被复用")
+		return 0, nil
+	})
+	if err != nil || v != 42 {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+}
+
+func TestOnceValueErrorNotCached(t *testing.T) {
+	var once OnceValue[int]
+	if _, err := once.Do(context.Background(), func(ctx context.Context) (int, error) {
+		return 0, errors.New("db down")
+	}); err == nil {
+		t.Fatal("应该返回错误")
+	}
+	if _, err := once.Do(context.Background(), func(ctx context.Context) (int, error) {
+		panic("boom")
+	}); err == nil {
+		t.Fatal("panic 应该转成错误")
+	}
+	v, err := once.Do(context.Background(), func(ctx context.Context) (int, error) { return 1, nil })
+	if err != nil || v != 1 {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+
+	once.Reset()
+	v, _ = once.Do(context.Background(), func(ctx context.Context) (int, error) { return 2, nil })
+	if v != 2 {
+		t.Fatalf("Reset 后 v = %d, want 2", v)
+	}
+}
+
+func TestKeyedOnce(t *testing.T) {
+	var conns KeyedOnce[string, string]
+	var calls sync.Map
+	dial := func(ctx context.Context, tenant string) (string, error) {
+		n, _ := calls.LoadOrStore(tenant, new(atomic.Int32))
+		n.(*atomic.Int32).Add(1)
+		return "conn-" + tenant, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tenant := fmt.Sprint("t", i%5)
+			if v, err := conns.Do(context.Background(), tenant, dial); err != nil || v != "conn-"+tenant {
+				t.Errorf("Do(%s) = %q, %v", tenant, v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	calls.Range(func(k, n any) bool {
+		if got := n.(*atomic.Int32).Load(); got != 1 {
+			t.Errorf("%v 初始化了 %d 次", k, got)
+		}
+		return true
+	})
+
+	conns.Forget("t0")
+	conns.Do(context.Background(), "t0", dial)
+	n, _ := calls.Load("t0")
+	if got := n.(*atomic.Int32).Load(); got != 2 {
+		t.Fatalf("Forget 后 t0 初始化了 %d 次, want 2", got)
+	}
+}
+
+// 一个键的初始化卡住不影响其他键
+func TestKeyedOnceIndependentKeys(t *testing.T) {
+	var ko KeyedOnce[int, int]
+	block := make(chan struct{})
+	defer close(block)
+	go ko.Do(context.Background(), 1, func(ctx context.Context, k int) (int, error) {
+		<-block
+		return k, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	v, err := ko.Do(ctx, 2, func(ctx context.Context, k int) (int, error) { return k, nil })
+	if err != nil || v != 2 {
+		t.Fatalf("Do(2) = %v, %v", v, err)
+	}
+}
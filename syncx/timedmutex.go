@@ -0,0 +1,247 @@
+package syncx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WaitBuckets 是 MutexStats.WaitHistogram 各档的上界，最后一档没有上界。
+var WaitBuckets = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// MutexStats 是 TimedMutex 的竞争统计。
+type MutexStats struct {
+	Acquired  uint64        // 加锁成功的次数
+	Contended uint64        // 需要等待的次数，包括最终没有拿到锁的
+	Timeouts  uint64        // 超时或 ctx 结束仍没有拿到锁的次数
+	WaitTotal time.Duration // 加锁成功之前等待的总时长
+	// WaitHistogram 是加锁成功之前等待时长的分布：第 i 档计数等待时长不超过 WaitBuckets[i]、
+	// 又超过前一档上界的加锁，最后一档计数超过一秒的。不用等待的加锁落在第一档。
+	WaitHistogram [len(WaitBuckets) + 1]uint64
+	LongHolds     uint64 // 持有时间超过告警阈值的次数
+}
+
+// Holder 描述当前持有锁的一方。
+type Holder struct {
+	Site  string    // 加锁的位置，形如 "pkg.Func file:line"
+	Since time.Time // 加锁的时间
+}
+
+// LongHold 是一次持有时间超过阈值的加锁。
+type LongHold struct {
+	Site string
+	Held time.Duration
+}
+
+// MutexOption 配置 TimedMutex。
+type MutexOption func(*mutexOptions)
+
+type mutexOptions struct {
+	holdWarning time.Duration
+	onLongHold  func(LongHold)
+}
+
+// WithHoldWarning 在持有时间超过 threshold 的锁被释放时调用 fn，fn 为 nil 时打印到标准错误。
+// fn 在锁释放之后调用，不会拖慢等待这把锁的其他 goroutine。
+func WithHoldWarning(threshold time.Duration, fn func(LongHold)) MutexOption {
+	return func(o *mutexOptions) {
+		o.holdWarning = threshold
+		o.onLongHold = fn
+	}
+}
+
+// TimedMutex 是可以放弃等待的互斥锁：LockCtx 随 ctx 结束返回，TryLockFor 最多等待给定的时长，
+// 不会像 sync.Mutex 那样在死锁时永远阻塞。它同时记录等待时长分布、当前持有者的加锁位置，
+// 以及持有时间过长的告警，用来在生产环境中找出热点锁。
+//
+// 零值可用，此时不做持有时间告警。与 sync.Mutex 一样，锁不属于特定的 goroutine。
+type TimedMutex struct {
+	init sync.Once
+	sem  chan struct{}
+
+	holdWarning time.Duration
+	onLongHold  func(LongHold)
+
+	// 持有者信息由加锁方在拿到锁之后写入，读取时两个字段可能短暂地不一致，只用于诊断
+	holderPC    atomic.Uintptr
+	holderSince atomic.Int64 // 距 monoBase 的纳秒数
+
+	acquired  atomic.Uint64
+	contended atomic.Uint64
+	timeouts  atomic.Uint64
+	longHolds atomic.Uint64
+	waitTotal atomic.Int64
+	hist      [len(WaitBuckets) + 1]atomic.Uint64
+}
+
+// monoBase 让持有时长用单调时钟计算，不受系统时间调整影响。
+var monoBase = time.Now()
+
+// NewTimedMutex 创建一个 TimedMutex。
+func NewTimedMutex(opts ...MutexOption) *TimedMutex {
+	var o mutexOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &TimedMutex{holdWarning: o.holdWarning, onLongHold: o.onLongHold}
+	m.semaphore()
+	return m
+}
+
+func (m *TimedMutex) semaphore() chan struct{} {
+	m.init.Do(func() {
+		m.sem = make(chan struct{}, 1)
+	})
+	return m.sem
+}
+
+// Lock 一直等待直到拿到锁。
+func (m *TimedMutex) Lock() {
+	m.lock(nil, nil)
+	m.setHolder()
+}
+
+// LockCtx 等待直到拿到锁或者 ctx 结束。拿到锁返回 nil，否则返回 ctx.Err()；ctx 已经结束时不会尝试加锁。
+func (m *TimedMutex) LockCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !m.lock(ctx.Done(), nil) {
+		return ctx.Err()
+	}
+	m.setHolder()
+	return nil
+}
+
+// TryLock 尝试加锁，不等待。
+func (m *TimedMutex) TryLock() bool {
+	select {
+	case m.semaphore() <- struct{}{}:
+	default:
+		return false
+	}
+	m.record(0)
+	m.setHolder()
+	return true
+}
+
+// TryLockFor 最多等待 d，返回是否拿到了锁。
+func (m *TimedMutex) TryLockFor(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	if !m.lock(nil, t.C) {
+		return false
+	}
+	m.setHolder()
+	return true
+}
+
+// lock 等待拿到锁，done 或 timeout 先到时返回 false。
+func (m *TimedMutex) lock(done <-chan struct{}, timeout <-chan time.Time) bool {
+	sem := m.semaphore()
+	select {
+	case sem <- struct{}{}:
+		m.record(0)
+		return true
+	default:
+	}
+
+	m.contended.Add(1)
+	start := time.Now()
+	select {
+	case sem <- struct{}{}:
+		m.record(time.Since(start))
+		return true
+	case <-done:
+	case <-timeout:
+	}
+	m.timeouts.Add(1)
+	return false
+}
+
+func (m *TimedMutex) record(wait time.Duration) {
+	m.acquired.Add(1)
+	m.waitTotal.Add(int64(wait))
+	i := 0
+	for i < len(WaitBuckets) && wait > WaitBuckets[i] {
+		i++
+	}
+	m.hist[i].Add(1)
+}
+
+// setHolder 记录调用加锁方法的位置，只取一个 PC，到需要时才解析成文件和行号。
+func (m *TimedMutex) setHolder() {
+	var pc [1]uintptr
+	runtime.Callers(3, pc[:])
+	m.holderSince.Store(int64(time.Since(monoBase)))
+	m.holderPC.Store(pc[0])
+}
+
+// Unlock 释放锁。对没有锁住的 TimedMutex 调用 Unlock 会 panic。
+func (m *TimedMutex) Unlock() {
+	pc := m.holderPC.Swap(0)
+	held := time.Since(monoBase) - time.Duration(m.holderSince.Load())
+
+	select {
+	case <-m.semaphore():
+	default:
+		panic("syncx: 对没有锁住的 TimedMutex 调用 Unlock")
+	}
+
+	if m.holdWarning > 0 && held > m.holdWarning {
+		m.longHolds.Add(1)
+		lh := LongHold{Site: callSite(pc), Held: held}
+		if m.onLongHold != nil {
+			m.onLongHold(lh)
+		} else {
+			fmt.Fprintf(os.Stderr, "syncx: 锁持有了 %v，超过告警阈值 %v，加锁于 %s\n", lh.Held, m.holdWarning, lh.Site)
+		}
+	}
+}
+
+// Holder 返回当前持有者的加锁位置和时间，没有被锁住时返回 false。
+func (m *TimedMutex) Holder() (Holder, bool) {
+	pc := m.holderPC.Load()
+	if pc == 0 {
+		return Holder{}, false
+	}
+	return Holder{
+		Site:  callSite(pc),
+		Since: monoBase.Add(time.Duration(m.holderSince.Load())),
+	}, true
+}
+
+func callSite(pc uintptr) string {
+	if pc == 0 {
+		return "未知位置"
+	}
+	f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+}
+
+// Stats 返回当前的竞争统计。
+func (m *TimedMutex) Stats() MutexStats {
+	st := MutexStats{
+		Acquired:  m.acquired.Load(),
+		Contended: m.contended.Load(),
+		Timeouts:  m.timeouts.Load(),
+		WaitTotal: time.Duration(m.waitTotal.Load()),
+		LongHolds: m.longHolds.Load(),
+	}
+	for i := range m.hist {
+		st.WaitHistogram[i] = m.hist[i].Load()
+	}
+	return st
+}
@@ -0,0 +1,210 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 用 TimedMutex 重写 TestDeadLock 的 printSum：两个 goroutine 按相反顺序加锁，
+// 等不到第二把锁时放弃并释放第一把，而不是永远互相等待。测试能结束本身就说明没有死锁
+func TestTimedMutexBreaksDeadlock(t *testing.T) {
+	type value struct {
+		mu    TimedMutex
+		value int
+	}
+	var a, b value
+	bothLocked := make(chan struct{}, 2)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	printSum := func(v1, v2 *value) {
+		defer wg.Done()
+		v1.mu.Lock()
+		defer v1.mu.Unlock()
+
+		// 确保两个 goroutine 都已经拿到第一把锁，制造死锁
+		bothLocked <- struct{}{}
+		for len(bothLocked) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := v2.mu.LockCtx(ctx); err != nil {
+			errs <- err
+			return
+		}
+		defer v2.mu.Unlock()
+		errs <- nil
+	}
+	wg.Add(2)
+	go printSum(&a, &b)
+	go printSum(&b, &a)
+	wg.Wait()
+
+	// 先放弃的一方释放了第一把锁，另一方可能因此拿到第二把锁
+	close(errs)
+	gaveUp := 0
+	for err := range errs {
+		if errors.Is(err, context.DeadlineExceeded) {
+			gaveUp++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	timeouts := a.mu.Stats().Timeouts + b.mu.Stats().Timeouts
+	if gaveUp == 0 || timeouts != uint64(gaveUp) {
+		t.Fatalf("放弃了 %d 次, Timeouts = %d", gaveUp, timeouts)
+	}
+}
+
+func TestTimedMutexLockCtx(t *testing.T) {
+	var mu TimedMutex
+	mu.Lock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mu.LockCtx(ctx); err != context.Canceled {
+		t.Fatalf("err = %v, want Canceled", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		mu.Unlock()
+	}()
+	if err := mu.LockCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Unlock()
+
+	st := mu.Stats()
+	if st.Acquired != 2 || st.Contended != 1 || st.WaitTotal < 10*time.Millisecond {
+		t.Fatalf("stats = %+v", st)
+	}
+	// 第一次不用等，落在第一档；第二次至少等了 10ms，落在 10ms 以上的档
+	var slow uint64
+	for _, n := range st.WaitHistogram[5:] {
+		slow += n
+	}
+	if st.WaitHistogram[0] != 1 || slow != 1 {
+		t.Fatalf("histogram = %v", st.WaitHistogram)
+	}
+}
+
+func TestTimedMutexTryLockFor(t *testing.T) {
+	mu := NewTimedMutex()
+	if !mu.TryLock() {
+		t.Fatal("没有锁住时 TryLock 应该成功")
+	}
+	if mu.TryLock() {
+		t.Fatal("已经锁住时 TryLock 应该失败")
+	}
+
+	start := time.Now()
+	if mu.TryLockFor(20 * time.Millisecond) {
+		t.Fatal("锁一直被持有, TryLockFor 应该失败")
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Fatalf("只等了 %v", waited)
+	}
+
+	time.AfterFunc(10*time.Millisecond, mu.Unlock)
+	if !mu.TryLockFor(time.Second) {
+		t.Fatal("锁在期限内被释放, TryLockFor 应该成功")
+	}
+	mu.Unlock()
+}
+
+func TestTimedMutexHolder(t *testing.T) {
+	var mu TimedMutex
+	if _, ok := mu.Holder(); ok {
+		t.Fatal("没有锁住时不应该有持有者")
+	}
+
+	for _, lock := range []func(){
+		mu.Lock,
+		func() { mu.LockCtx(context.Background()) },
+		func() { mu.TryLock() },
+		func() { mu.TryLockFor(time.Second) },
+	} {
+		lock()
+		h, ok := mu.Holder()
+		if !ok || !strings.Contains(h.Site, "TestTimedMutexHolder") || !strings.Contains(h.Site, "timedmutex_test.go") {
+			t.Fatalf("Holder = %+v, 应该指向测试中的加锁位置", h)
+		}
+		if time.Since(h.Since) > time.Second {
+			t.Fatalf("Since = %v", h.Since)
+		}
+		mu.Unlock()
+	}
+	if _, ok := mu.Holder(); ok {
+		t.Fatal("解锁后不应该有持有者")
+	}
+}
+
+func TestTimedMutexHoldWarning(t *testing.T) {
+	var warnings []LongHold
+	mu := NewTimedMutex(WithHoldWarning(10*time.Millisecond, func(lh LongHold) {
+		warnings = append(warnings, lh)
+	}))
+
+	mu.Lock()
+	mu.Unlock()
+	mu.Lock()
+	time.Sleep(20 * time.Millisecond)
+	mu.Unlock()
+
+	if len(warnings) != 1 {
+		t.Fatalf("告警了 %d 次, want 1", len(warnings))
+	}
+	if w := warnings[0]; w.Held < 20*time.Millisecond || !strings.Contains(w.Site, "TestTimedMutexHoldWarning") {
+		t.Fatalf("warning = %+v", w)
+	}
+	if st := mu.Stats(); st.LongHolds != 1 {
+		t.Fatalf("LongHolds = %d", st.LongHolds)
+	}
+}
+
+func TestTimedMutexUnlockUnlocked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("对没有锁住的锁 Unlock 应该 panic")
+		}
+	}()
+	var mu TimedMutex
+	mu.Unlock()
+}
+
+func TestTimedMutexExcludes(t *testing.T) {
+	var mu TimedMutex
+	count := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !mu.TryLockFor(time.Second) {
+					t.Error("TryLockFor 超时")
+					return
+				}
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	st := mu.Stats()
+	var total uint64
+	for _, n := range st.WaitHistogram {
+		total += n
+	}
+	if count != 2000 || st.Acquired != 2000 || total != st.Acquired {
+		t.Fatalf("count = %d, stats = %+v", count, st)
+	}
+}